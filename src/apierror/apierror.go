@@ -0,0 +1,136 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error types, as the OpenAI API names them
+const (
+	TypeInvalidRequest    = "invalid_request_error"
+	TypeAuthentication    = "authentication_error"
+	TypePermission        = "permission_error"
+	TypeNotFound          = "not_found_error"
+	TypeRateLimit         = "rate_limit_error"
+	TypeInsufficientQuota = "insufficient_quota"
+	TypeServer            = "server_error"
+)
+
+// Error codes the proxy returns
+const (
+	CodeInvalidAPIKey           = "invalid_api_key"
+	CodeAdminRequired           = "admin_required"
+	CodeModelNotFound           = "model_not_found"
+	CodeModelInactive           = "model_inactive"
+	CodeContextLengthExceeded   = "context_length_exceeded"
+	CodeRateLimited             = "rate_limited"
+	CodeBudgetExhausted         = "budget_exhausted"
+	CodeFirewallBlocked         = "firewall_blocked"
+	CodeUpstreamUnavailable     = "upstream_unavailable"
+	CodeUpstreamInvalidResponse = "upstream_invalid_response"
+)
+
+// Error is an OpenAI-style error. It is written as
+// {"error": {"message", "type", "code", "param"}}, which the OpenAI SDKs
+// parse into typed exceptions.
+type Error struct {
+	Status   int
+	Message  string
+	Type     string
+	Code     string    // Empty is written as null
+	Param    string    // Request field the error is about, empty is written as null
+	Firewall *Firewall // Set for firewall_blocked
+}
+
+// Firewall says which firewall blocked a request and why
+type Firewall struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// New creates an error with the type that goes with the status code
+func New(status int, message string) *Error {
+	return &Error{Status: status, Message: message, Type: typeFor(status)}
+}
+
+// WithCode sets the error's code
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithParam sets the request field the error is about
+func (e *Error) WithParam(param string) *Error {
+	e.Param = param
+	return e
+}
+
+// FirewallBlocked is returned when an enforcing firewall rejects a request
+func FirewallBlocked(firewallID, firewallType, reason string) *Error {
+	e := New(http.StatusForbidden, fmt.Sprintf("request rejected: blocked by %s firewall", firewallType)).WithCode(CodeFirewallBlocked)
+	e.Firewall = &Firewall{ID: firewallID, Type: firewallType, Reason: reason}
+	return e
+}
+
+// Object is the error as the value of an "error" field
+func (e *Error) Object() gin.H {
+	object := gin.H{
+		"message": e.Message,
+		"type":    e.Type,
+		"code":    nullable(e.Code),
+		"param":   nullable(e.Param),
+	}
+	if e.Firewall != nil {
+		object["firewall"] = e.Firewall
+	}
+	return object
+}
+
+// Write answers the request with an error. Errors that aren't an *Error are
+// written with the given status and the type that goes with it.
+func Write(c *gin.Context, status int, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = New(status, err.Error())
+	}
+	c.JSON(apiErr.Status, gin.H{"error": apiErr.Object()})
+}
+
+// Abort answers the request with an error made from a status and message
+func Abort(c *gin.Context, status int, message string) {
+	Write(c, status, New(status, message))
+}
+
+func typeFor(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return TypeAuthentication
+	case status == http.StatusPaymentRequired:
+		return TypeInsufficientQuota
+	case status == http.StatusForbidden:
+		return TypePermission
+	case status == http.StatusNotFound:
+		return TypeNotFound
+	case status == http.StatusTooManyRequests:
+		return TypeRateLimit
+	case status >= 500:
+		return TypeServer
+	default:
+		return TypeInvalidRequest
+	}
+}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"covalence/src/db/s3"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const ContentType = "application/gzip"
+
+// Record is one archived request with everything recorded about it. Archive
+// objects are gzipped JSON lines, one record per line.
+type Record struct {
+	Request        sqlc.RequestLog        `json:"request"`
+	Responses      []sqlc.ResponseLog     `json:"responses"`
+	FirewallEvents []sqlc.FirewallEvent   `json:"firewall_events"`
+	Attempts       []sqlc.UpstreamAttempt `json:"attempts"`
+}
+
+// Archiver moves audit traces from Postgres to object storage
+type Archiver struct {
+	db    *postgres.DB
+	store *s3.Client
+	cfg   Config
+}
+
+func New(db *postgres.DB, store *s3.Client, cfg Config) *Archiver {
+	return &Archiver{db: db, store: store, cfg: cfg}
+}
+
+// Start archives every interval until the context is cancelled
+func (a *Archiver) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(a.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := a.Run(ctx); err != nil {
+				log.Printf("audit archiving failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run archives every request waiting to be archived, then prunes archived
+// requests older than the retention period
+func (a *Archiver) Run(ctx context.Context) error {
+	total := 0
+	for {
+		n, err := a.archiveBatch(ctx)
+		if err != nil {
+			return err
+		}
+		total += n
+		if n < a.cfg.BatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Printf("archived %d audit traces", total)
+	}
+
+	if a.cfg.Retention > 0 {
+		cutoff := pgtype.Timestamptz{Time: time.Now().Add(-a.cfg.Retention), Valid: true}
+		pruned, err := a.db.Queries.DeleteArchivedRequestsBefore(ctx, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to prune archived requests: %w", err)
+		}
+		if pruned > 0 {
+			log.Printf("pruned %d archived requests from postgres", pruned)
+		}
+	}
+
+	return nil
+}
+
+// archiveBatch writes one object of up to BatchSize requests and records
+// where each went. The requests stay locked until they are marked archived.
+// If that fails after the upload, the object is left behind and the requests
+// are archived again on the next run. Nothing is archived while any of the
+// batch's rows breaks the audit hash chain.
+func (a *Archiver) archiveBatch(ctx context.Context) (int, error) {
+	tx, err := a.db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	q := a.db.Queries.WithTx(tx)
+
+	requests, err := q.GetUnarchivedRequests(ctx, int32(a.cfg.BatchSize))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get unarchived requests: %w", err)
+	}
+	if len(requests) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]pgtype.UUID, len(requests))
+	for i, r := range requests {
+		ids[i] = r.RequestID
+	}
+
+	broken, err := q.ListBrokenLinksForRequests(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify audit chain: %w", err)
+	}
+	if len(broken) > 0 {
+		return 0, fmt.Errorf("audit chain is broken at link %d in %s, not archiving", broken[0].ChainSeq, broken[0].TableName)
+	}
+
+	records, err := collect(ctx, q, ids, requests)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := Encode(records)
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	key := path.Join(a.cfg.Prefix, time.Now().UTC().Format("2006/01/02"), uuid.New().String()+".jsonl.gz")
+	if err := a.store.UploadObject(a.cfg.Bucket, key, data, ContentType); err != nil {
+		return 0, err
+	}
+	location := Location(a.cfg.Bucket, key)
+
+	// Keep the links so the chain can still be verified once the rows are pruned
+	err = q.InsertArchivedLinksForRequests(ctx, sqlc.InsertArchivedLinksForRequestsParams{
+		Column1: ids,
+		S3Path:  location,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record archived links: %w", err)
+	}
+
+	for _, r := range requests {
+		_, err := q.InsertAuditArchive(ctx, sqlc.InsertAuditArchiveParams{
+			RequestID:   r.RequestID,
+			S3Path:      location,
+			ArchiveHash: pgtype.Text{String: hash, Valid: true},
+			ReceivedAt:  r.ReceivedAt,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to record archive: %w", err)
+		}
+		if err := q.MarkRequestArchived(ctx, r.RequestID); err != nil {
+			return 0, fmt.Errorf("failed to mark request archived: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(requests), nil
+}
+
+// collect gathers the rows recorded for each request
+func collect(ctx context.Context, q *sqlc.Queries, ids []pgtype.UUID, requests []sqlc.RequestLog) ([]Record, error) {
+	records := make([]Record, len(requests))
+	index := make(map[pgtype.UUID]int, len(requests))
+	for i, r := range requests {
+		records[i] = Record{
+			Request:        r,
+			Responses:      []sqlc.ResponseLog{},
+			FirewallEvents: []sqlc.FirewallEvent{},
+			Attempts:       []sqlc.UpstreamAttempt{},
+		}
+		index[r.RequestID] = i
+	}
+
+	responses, err := q.ListResponseLogsForRequests(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get responses: %w", err)
+	}
+	for _, r := range responses {
+		i := index[r.RequestID]
+		records[i].Responses = append(records[i].Responses, r)
+	}
+
+	events, err := q.ListFirewallEventsForRequests(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get firewall events: %w", err)
+	}
+	for _, e := range events {
+		i := index[e.RequestID]
+		records[i].FirewallEvents = append(records[i].FirewallEvents, e)
+	}
+
+	attempts, err := q.ListUpstreamAttemptsForRequests(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upstream attempts: %w", err)
+	}
+	for _, at := range attempts {
+		i := index[at.RequestID]
+		records[i].Attempts = append(records[i].Attempts, at)
+	}
+
+	return records, nil
+}
+
+// Encode writes records as gzipped JSON lines
+func Encode(records []Record) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return nil, fmt.Errorf("failed to encode archive record: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Location is how an archive object is recorded in audit_archives.s3_path
+func Location(bucket, key string) string {
+	return fmt.Sprintf("s3://%s/%s", bucket, key)
+}
@@ -0,0 +1,124 @@
+package archive
+
+import (
+	"covalence/src/db/s3"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultInterval  = 5 * time.Minute
+	DefaultBatchSize = 1000
+	DefaultPrefix    = "audit"
+)
+
+// Config controls where and how often audit traces are archived. It is read
+// once at startup. The zero value archives nothing.
+type Config struct {
+	Enabled   bool
+	Bucket    string
+	Prefix    string        // Key prefix for archive objects
+	Interval  time.Duration // Time between archiving runs
+	BatchSize int           // Requests per archive object
+	Retention time.Duration // How long archived requests stay in Postgres, 0 keeps them
+	S3        s3.Config
+}
+
+type rawConfig struct {
+	Archive struct {
+		Enabled   bool   `yaml:"enabled"`
+		Bucket    string `yaml:"bucket"`
+		Prefix    string `yaml:"prefix"`
+		Interval  string `yaml:"interval"`
+		BatchSize int    `yaml:"batch_size"`
+		Retention string `yaml:"retention"`
+		S3        struct {
+			Endpoint       string `yaml:"endpoint"`
+			Region         string `yaml:"region"`
+			AccessKeyEnv   string `yaml:"access_key_env"`
+			SecretKeyEnv   string `yaml:"secret_key_env"`
+			UseSSL         bool   `yaml:"use_ssl"`
+			ForcePathStyle bool   `yaml:"force_path_style"`
+		} `yaml:"s3"`
+	} `yaml:"archive"`
+}
+
+// ReadConfig reads the archive section of a config file. Credentials are read
+// from the environment variables it names.
+func ReadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var raw rawConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Config{}, err
+	}
+
+	a := raw.Archive
+	if !a.Enabled {
+		return Config{}, nil
+	}
+
+	cfg := Config{
+		Enabled:   true,
+		Bucket:    a.Bucket,
+		Prefix:    DefaultPrefix,
+		Interval:  DefaultInterval,
+		BatchSize: DefaultBatchSize,
+		S3: s3.Config{
+			Endpoint:        a.S3.Endpoint,
+			Region:          a.S3.Region,
+			AccessKeyID:     os.Getenv(a.S3.AccessKeyEnv),
+			SecretAccessKey: os.Getenv(a.S3.SecretKeyEnv),
+			UseSSL:          a.S3.UseSSL,
+			ForcePathStyle:  a.S3.ForcePathStyle,
+		},
+	}
+
+	if cfg.Bucket == "" {
+		return Config{}, errors.New("archive: bucket is required")
+	}
+	if cfg.S3.Endpoint == "" || cfg.S3.Region == "" {
+		return Config{}, errors.New("archive: s3 endpoint and region are required")
+	}
+	if a.Prefix != "" {
+		cfg.Prefix = a.Prefix
+	}
+
+	if a.Interval != "" {
+		interval, err := time.ParseDuration(a.Interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("archive: invalid interval: %w", err)
+		}
+		if interval <= 0 {
+			return Config{}, errors.New("archive: interval must be positive")
+		}
+		cfg.Interval = interval
+	}
+
+	if a.BatchSize < 0 {
+		return Config{}, errors.New("archive: batch_size cannot be negative")
+	}
+	if a.BatchSize > 0 {
+		cfg.BatchSize = a.BatchSize
+	}
+
+	if a.Retention != "" {
+		retention, err := time.ParseDuration(a.Retention)
+		if err != nil {
+			return Config{}, fmt.Errorf("archive: invalid retention: %w", err)
+		}
+		if retention < 0 {
+			return Config{}, errors.New("archive: retention cannot be negative")
+		}
+		cfg.Retention = retention
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,234 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"covalence/src/db/s3"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ErrNotArchived is returned by Lookup for requests that have no archive
+var ErrNotArchived = errors.New("request has not been archived")
+
+// Lookup reads a request's record back from the object it was archived to
+func Lookup(ctx context.Context, db *postgres.DB, store *s3.Client, requestID pgtype.UUID) (Record, error) {
+	archived, err := db.Queries.GetAuditArchiveForRequest(ctx, requestID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Record{}, ErrNotArchived
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to get archive: %w", err)
+	}
+
+	records, err := Fetch(store, archived.S3Path, archived.ArchiveHash)
+	if err != nil {
+		return Record{}, err
+	}
+	for _, r := range records {
+		if r.Request.RequestID == requestID {
+			return r, nil
+		}
+	}
+	return Record{}, fmt.Errorf("request %s is missing from %s", requestID.String(), archived.S3Path)
+}
+
+// Restore copies requests received in [from, to) back into Postgres from their
+// archives, with their responses, firewall events and upstream attempts.
+// Requests still in Postgres are skipped. Restored rows keep their audit chain
+// links, and are kept for another retention period from when they were
+// restored. It returns how many requests were restored.
+func Restore(ctx context.Context, db *postgres.DB, store *s3.Client, from, to time.Time) (int, error) {
+	archives, err := db.Queries.ListAuditArchivesReceivedBetween(ctx, sqlc.ListAuditArchivesReceivedBetweenParams{
+		ReceivedAt:   pgtype.Timestamptz{Time: from, Valid: true},
+		ReceivedAt_2: pgtype.Timestamptz{Time: to, Valid: true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	total := 0
+	for _, a := range archives {
+		records, err := Fetch(store, a.S3Path, a.ArchiveHash)
+		if err != nil {
+			return total, err
+		}
+
+		var restore []Record
+		for _, r := range records {
+			received := r.Request.ReceivedAt.Time
+			if !received.Before(from) && received.Before(to) {
+				restore = append(restore, r)
+			}
+		}
+
+		n, err := restoreRecords(ctx, db, restore)
+		if err != nil {
+			return total, fmt.Errorf("failed to restore %s: %w", a.S3Path, err)
+		}
+		total += n
+	}
+
+	return total, nil
+}
+
+// restoreRecords writes the records that aren't in Postgres in one transaction
+func restoreRecords(ctx context.Context, db *postgres.DB, records []Record) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	q := db.Queries.WithTx(tx)
+
+	ids := make([]pgtype.UUID, len(records))
+	for i, r := range records {
+		ids[i] = r.Request.RequestID
+	}
+	existing, err := q.ListExistingRequests(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check existing requests: %w", err)
+	}
+	present := make(map[pgtype.UUID]bool, len(existing))
+	for _, id := range existing {
+		present[id] = true
+	}
+
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	var (
+		requests  []sqlc.RestoreRequestLogsParams
+		responses []sqlc.RestoreResponseLogsParams
+		events    []sqlc.RestoreFirewallEventsParams
+		attempts  []sqlc.RestoreUpstreamAttemptsParams
+	)
+	for _, r := range records {
+		if present[r.Request.RequestID] {
+			continue
+		}
+		// Restoring the same request twice from one range only writes it once
+		present[r.Request.RequestID] = true
+
+		req := r.Request
+		requests = append(requests, sqlc.RestoreRequestLogsParams{
+			RequestID:  req.RequestID,
+			UserID:     req.UserID,
+			ApiKeyID:   req.ApiKeyID,
+			Model:      req.Model,
+			TargetUrl:  req.TargetUrl,
+			Inputs:     req.Inputs,
+			Parameters: req.Parameters,
+			ReceivedAt: req.ReceivedAt,
+			ClientIp:   req.ClientIp,
+			Archived:   pgtype.Bool{Bool: true, Valid: true},
+			Alias:      req.Alias,
+			ChainSeq:   req.ChainSeq,
+			PrevHash:   req.PrevHash,
+			RowHash:    req.RowHash,
+			RestoredAt: now,
+		})
+		for _, res := range r.Responses {
+			responses = append(responses, sqlc.RestoreResponseLogsParams(res))
+		}
+		for _, e := range r.FirewallEvents {
+			events = append(events, sqlc.RestoreFirewallEventsParams(e))
+		}
+		for _, at := range r.Attempts {
+			attempts = append(attempts, sqlc.RestoreUpstreamAttemptsParams(at))
+		}
+	}
+	if len(requests) == 0 {
+		return 0, nil
+	}
+
+	// Requests first, the other tables reference them
+	if _, err := q.RestoreRequestLogs(ctx, requests); err != nil {
+		return 0, fmt.Errorf("failed to restore requests: %w", err)
+	}
+	if _, err := q.RestoreResponseLogs(ctx, responses); err != nil {
+		return 0, fmt.Errorf("failed to restore responses: %w", err)
+	}
+	if _, err := q.RestoreFirewallEvents(ctx, events); err != nil {
+		return 0, fmt.Errorf("failed to restore firewall events: %w", err)
+	}
+	if _, err := q.RestoreUpstreamAttempts(ctx, attempts); err != nil {
+		return 0, fmt.Errorf("failed to restore upstream attempts: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(requests), nil
+}
+
+// Fetch downloads an archive object and checks it against the SHA-256
+// recorded when it was written
+func Fetch(store *s3.Client, location string, hash pgtype.Text) ([]Record, error) {
+	bucket, key, err := ParseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.DownloadObject(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash.Valid {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != hash.String {
+			return nil, fmt.Errorf("archive %s doesn't match its recorded hash", location)
+		}
+	}
+
+	return Decode(data)
+}
+
+// Decode reads records written by Encode
+func Decode(data []byte) ([]Record, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer zr.Close()
+
+	var records []Record
+	dec := json.NewDecoder(zr)
+	for {
+		var r Record
+		err := dec.Decode(&r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode archive record: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// ParseLocation splits an audit_archives.s3_path into its bucket and key
+func ParseLocation(location string) (string, string, error) {
+	rest, ok := strings.CutPrefix(location, "s3://")
+	bucket, key, found := strings.Cut(rest, "/")
+	if !ok || !found || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid archive location %q", location)
+	}
+	return bucket, key, nil
+}
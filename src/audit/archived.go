@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"covalence/src/archive"
+)
+
+// traceFromRecord builds a trace from an archived record the same way GetTrace
+// builds one from Postgres
+func traceFromRecord(r archive.Record) (Trace, error) {
+	req := r.Request
+
+	var params map[string]interface{}
+	json.Unmarshal(req.Parameters, &params) // Ignoring error, empty map is fine
+
+	var inputs []map[string]interface{}
+	for _, input := range req.Inputs {
+		var msg map[string]interface{}
+		if err := json.Unmarshal(input, &msg); err != nil {
+			return Trace{}, fmt.Errorf("invalid messages: %w", err)
+		}
+		inputs = append(inputs, msg)
+	}
+
+	trace := Trace{
+		RequestID:         req.RequestID.String(),
+		UserID:            req.UserID.String(),
+		Model:             req.Model,
+		Alias:             req.Alias,
+		TargetURL:         req.TargetUrl,
+		Inputs:            inputs,
+		RequestParameters: params,
+		FromArchive:       true,
+	}
+	if req.ClientIp != nil {
+		trace.ClientIP = req.ClientIp.String()
+	}
+
+	if len(r.Responses) > 0 {
+		res := r.Responses[0]
+		if err := json.Unmarshal(res.Response, &trace.Response); err != nil {
+			return Trace{}, fmt.Errorf("invalid response: %w", err)
+		}
+		trace.PromptTokens = int64(res.PromptTokens)
+		trace.CompletionTokens = int64(res.CompletionTokens)
+		trace.CostUSD = res.CostUsd
+		trace.CacheHit = res.CacheHit
+		trace.CacheSimilarity = res.CacheSimilarity.Float64
+	}
+
+	events := []FirewallEvent{}
+	for _, e := range r.FirewallEvents {
+		riskScore, err := e.RiskScore.Float64Value()
+		if err != nil {
+			return Trace{}, fmt.Errorf("invalid risk score: %w", err)
+		}
+		events = append(events, FirewallEvent{
+			RequestID:     e.RequestID.String(),
+			FirewallID:    e.FirewallID,
+			FirewallType:  e.FirewallType,
+			Mode:          e.Mode,
+			Version:       e.FirewallVersion,
+			Blocked:       e.Blocked.Bool,
+			BlockedReason: e.BlockedReason.String,
+			RiskScore:     riskScore.Float64,
+		})
+	}
+	trace.FirewallInfo = events
+
+	// Like GetTrace, the request-level verdict is the first firewall event's
+	if len(events) > 0 {
+		trace.RiskScore = events[0].RiskScore
+		trace.Blocked = events[0].Blocked
+		trace.BlockedReason = events[0].BlockedReason
+	}
+
+	attempts := []Attempt{}
+	for _, a := range r.Attempts {
+		attempts = append(attempts, Attempt{
+			RequestID:  a.RequestID.String(),
+			Attempt:    a.Attempt,
+			Model:      a.Model,
+			Provider:   a.Provider,
+			TargetURL:  a.TargetUrl,
+			StatusCode: int(a.StatusCode.Int32),
+			Error:      a.Error.String,
+			LatencyMs:  int64(a.LatencyMs.Int32),
+		})
+	}
+	trace.Attempts = attempts
+
+	return trace, nil
+}
@@ -3,63 +3,100 @@ package audit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/netip"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 
+	"covalence/src/archive"
 	"covalence/src/db/postgres"
 	"covalence/src/db/postgres/sqlc"
+	"covalence/src/db/s3"
 )
 
+// ErrTraceNotFound is returned for requests that are neither in Postgres nor archived
+var ErrTraceNotFound = errors.New("request not found")
+
 // Trace represents a full request trace with all related data
 type Trace struct {
 	RequestID         string
 	UserID            string
 	Model             string
+	Alias             string
+	TargetURL         string
 	Inputs            []map[string]interface{}
 	Response          map[string]interface{}
+	PromptTokens      int64
+	CompletionTokens  int64
+	CostUSD           float64
+	CacheHit          bool    // Served from the response cache without calling the provider
+	CacheSimilarity   float64 // For semantic cache hits, how close the prompt was to the cached one
 	RequestParameters map[string]interface{}
 	FirewallInfo      []FirewallEvent
+	Attempts          []Attempt
 	ClientIP          string
 	RiskScore         float64
 	Blocked           bool
 	BlockedReason     string
+	FromArchive       bool // Read back from the archive after being pruned from Postgres
 }
 
 type FirewallEvent struct {
 	RequestID     string
 	FirewallID    string
 	FirewallType  string
+	Mode          string // enforce or monitor; for monitor, Blocked means "would have blocked"
+	Version       int32  // Stored firewall config version, 0 for config.yaml firewalls
 	Blocked       bool
 	BlockedReason string
 	RiskScore     float64
 }
 
+// Attempt is one upstream call made for a request. A request has several when
+// targets fail and it falls back.
+type Attempt struct {
+	RequestID  string
+	Attempt    int32
+	Model      string
+	Provider   string
+	TargetURL  string
+	StatusCode int    // 0 when no response was received
+	Error      string // Transport error or reason the attempt failed
+	LatencyMs  int64
+}
+
+// FirewallStats summarises the verdicts recorded for a firewall in a given mode
+type FirewallStats struct {
+	FirewallID   string
+	FirewallType string
+	Mode         string
+	Total        int64
+	Blocked      int64
+}
+
 type Request struct {
 	UserID     string
 	APIKeyID   string
-	Model      string
+	Model      string // Model of the backend the request was routed to
+	Alias      string // Registered model name the client asked for
 	TargetURL  string
 	Inputs     []map[string]interface{}
 	Parameters map[string]interface{}
 	ClientIP   string
 }
 
-// LogRequest creates a request log entry
-func LogRequest(ctx context.Context, r Request, db *postgres.DB) (string, error) {
-
-	db.Mu.Lock()
-	defer db.Mu.Unlock()
-
+// requestRow converts a request into its request_logs row
+func requestRow(r Request, requestID string, at time.Time) (sqlc.InsertRequestLogsParams, error) {
 	// Messages parameters to JSON
 	// Convert each message to JSON and store in a list
 	var inputBytesList [][]byte
 	for _, input := range r.Inputs {
 		inputBytes, err := json.Marshal(input)
 		if err != nil {
-			return "", fmt.Errorf("invalid messages: %w", err)
+			return sqlc.InsertRequestLogsParams{}, fmt.Errorf("invalid messages: %w", err)
 		}
 		inputBytesList = append(inputBytesList, inputBytes)
 	}
@@ -67,7 +104,7 @@ func LogRequest(ctx context.Context, r Request, db *postgres.DB) (string, error)
 	// Convert parameters to JSON
 	paramsBytes, err := json.Marshal(r.Parameters)
 	if err != nil {
-		return "", fmt.Errorf("invalid parameters: %w", err)
+		return sqlc.InsertRequestLogsParams{}, fmt.Errorf("invalid parameters: %w", err)
 	}
 
 	// Parse IP if provided
@@ -75,18 +112,19 @@ func LogRequest(ctx context.Context, r Request, db *postgres.DB) (string, error)
 	if r.ClientIP != "" {
 		ip, err := netip.ParseAddr(r.ClientIP)
 		if err != nil {
-			return "", fmt.Errorf("invalid IP: %w", err)
+			return sqlc.InsertRequestLogsParams{}, fmt.Errorf("invalid IP: %w", err)
 		}
 		clientIP = &ip
 	}
 
 	// Prepare pgtype values
-	var userUUID, apiKeyUUID pgtype.UUID
+	var reqUUID, userUUID, apiKeyUUID pgtype.UUID
+	reqUUID.Scan(requestID)
 	userUUID.Scan(r.UserID)
 	apiKeyUUID.Scan(r.APIKeyID)
 
-	// Execute insert
-	req, err := db.Queries.InsertRequestLog(ctx, sqlc.InsertRequestLogParams{
+	return sqlc.InsertRequestLogsParams{
+		RequestID:  reqUUID,
 		UserID:     userUUID,
 		ApiKeyID:   apiKeyUUID,
 		Model:      r.Model,
@@ -94,27 +132,24 @@ func LogRequest(ctx context.Context, r Request, db *postgres.DB) (string, error)
 		Inputs:     inputBytesList,
 		Parameters: paramsBytes,
 		ClientIp:   clientIP,
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	return req.RequestID.String(), nil
+		Alias:      r.Alias,
+		ReceivedAt: pgtype.Timestamptz{Time: at, Valid: true},
+	}, nil
 }
 
 type Response struct {
-	RequestID string
-	Response  map[string]interface{}
-	LatencyMs int64
+	RequestID        string
+	Response         map[string]interface{}
+	LatencyMs        int64
+	PromptTokens     int64
+	CompletionTokens int64
+	CostUSD          float64
+	CacheHit         bool
+	CacheSimilarity  float64 // 0 unless served by the semantic cache
 }
 
-// LogResponse records a response to an existing request
-func LogResponse(ctx context.Context, r Response, db *postgres.DB) error {
-
-	db.Mu.Lock()
-	defer db.Mu.Unlock()
-
+// responseRow converts a response into its response_logs row
+func responseRow(r Response, at time.Time) (sqlc.InsertResponseLogsParams, error) {
 	var reqUUID pgtype.UUID
 	reqUUID.Scan(r.RequestID)
 
@@ -124,68 +159,106 @@ func LogResponse(ctx context.Context, r Response, db *postgres.DB) error {
 	// Turn Parameters into bytes json
 	responseBytes, err := json.Marshal(r.Response)
 	if err != nil {
-		return fmt.Errorf("invalid response: %w", err)
+		return sqlc.InsertResponseLogsParams{}, fmt.Errorf("invalid response: %w", err)
 	}
 
-	_, err = db.Queries.InsertResponseLog(ctx, sqlc.InsertResponseLogParams{
-		RequestID: reqUUID,
-		Response:  responseBytes,
-		LatencyMs: pgLatency,
-	})
-
-	return err
+	// Generated here rather than by Postgres, so a replayed row is recognised
+	var responseUUID pgtype.UUID
+	responseUUID.Scan(NewUUID())
+
+	return sqlc.InsertResponseLogsParams{
+		ResponseID:       responseUUID,
+		RequestID:        reqUUID,
+		Response:         responseBytes,
+		LatencyMs:        pgLatency,
+		PromptTokens:     int32(r.PromptTokens),
+		CompletionTokens: int32(r.CompletionTokens),
+		CostUsd:          r.CostUSD,
+		CacheHit:         r.CacheHit,
+		CacheSimilarity:  pgtype.Float8{Float64: r.CacheSimilarity, Valid: r.CacheSimilarity > 0},
+		CreatedAt:        pgtype.Timestamptz{Time: at, Valid: true},
+	}, nil
 }
 
-// LogFirewall records a firewall event for a request
-func LogFirewallEvent(ctx context.Context, fe FirewallEvent, db *postgres.DB) error {
-
-	db.Mu.Lock()
-	defer db.Mu.Unlock()
-
+// firewallEventRow converts a firewall event into its firewall_events row
+func firewallEventRow(fe FirewallEvent, at time.Time) (sqlc.InsertFirewallEventsParams, error) {
 	// Convert request ID
 	var reqUUID pgtype.UUID
 	err := reqUUID.Scan(fe.RequestID)
 	if err != nil {
-		return fmt.Errorf("invalid request ID: %w", err)
+		return sqlc.InsertFirewallEventsParams{}, fmt.Errorf("invalid request ID: %w", err)
 	}
 
 	var blocked pgtype.Bool
 	err = blocked.Scan(fe.Blocked)
 	if err != nil {
-		return fmt.Errorf("invalid blocked value: %w", err)
+		return sqlc.InsertFirewallEventsParams{}, fmt.Errorf("invalid blocked value: %w", err)
 	}
 
 	var blockedReason pgtype.Text
 	err = blockedReason.Scan(fe.BlockedReason)
 	if err != nil {
-		return fmt.Errorf("invalid blocked reason: %w", err)
+		return sqlc.InsertFirewallEventsParams{}, fmt.Errorf("invalid blocked reason: %w", err)
 	}
 
 	var riskScore pgtype.Numeric
 	err = riskScore.Scan(fmt.Sprintf("%f", fe.RiskScore))
 	if err != nil {
-		return fmt.Errorf("invalid risk score: %w", err)
+		return sqlc.InsertFirewallEventsParams{}, fmt.Errorf("invalid risk score: %w", err)
 	}
 
-	_, err = db.Queries.InsertFirewallEvent(ctx, sqlc.InsertFirewallEventParams{
-		RequestID:     reqUUID,
-		FirewallID:    fe.FirewallID,
-		FirewallType:  fe.FirewallType,
-		Blocked:       blocked,
-		BlockedReason: blockedReason,
-		RiskScore:     riskScore,
-	})
-
-	return err
+	var eventUUID pgtype.UUID
+	eventUUID.Scan(NewUUID())
+
+	return sqlc.InsertFirewallEventsParams{
+		FirewallEventID: eventUUID,
+		RequestID:       reqUUID,
+		FirewallID:      fe.FirewallID,
+		FirewallType:    fe.FirewallType,
+		Blocked:         blocked,
+		BlockedReason:   blockedReason,
+		RiskScore:       riskScore,
+		Mode:            fe.Mode,
+		FirewallVersion: fe.Version,
+		EvaluatedAt:     pgtype.Timestamptz{Time: at, Valid: true},
+	}, nil
 }
 
-// GetTrace retrieves the full trace for a request
-func GetTrace(ctx context.Context, requestID string, db *postgres.DB) (Trace, error) {
-	db.Mu.Lock()
-	defer db.Mu.Unlock()
+// attemptRow converts an upstream call into its upstream_attempts row
+func attemptRow(a Attempt, at time.Time) sqlc.InsertUpstreamAttemptsParams {
+	var reqUUID pgtype.UUID
+	reqUUID.Scan(a.RequestID)
+
+	statusCode := pgtype.Int4{Int32: int32(a.StatusCode), Valid: a.StatusCode != 0}
+	errorText := pgtype.Text{String: a.Error, Valid: a.Error != ""}
 
+	var pgLatency pgtype.Int4
+	pgLatency.Scan(a.LatencyMs)
+
+	var attemptUUID pgtype.UUID
+	attemptUUID.Scan(NewUUID())
+
+	return sqlc.InsertUpstreamAttemptsParams{
+		AttemptID:  attemptUUID,
+		RequestID:  reqUUID,
+		Attempt:    a.Attempt,
+		Model:      a.Model,
+		Provider:   a.Provider,
+		TargetUrl:  a.TargetURL,
+		StatusCode: statusCode,
+		Error:      errorText,
+		LatencyMs:  pgLatency,
+		CreatedAt:  pgtype.Timestamptz{Time: at, Valid: true},
+	}
+}
+
+// GetTrace retrieves the full trace for a request. Requests pruned from
+// Postgres are read back from their archive, unless store is nil.
+func GetTrace(ctx context.Context, requestID string, db *postgres.DB, store *s3.Client) (Trace, error) {
 	var reqUUID pgtype.UUID
-	reqUUID.Scan(requestID)
+	if err := reqUUID.Scan(requestID); err != nil {
+		return Trace{}, ErrTraceNotFound
+	}
 
 	rows, err := db.Queries.GetRequestFullTrace(ctx, reqUUID)
 	if err != nil {
@@ -193,7 +266,17 @@ func GetTrace(ctx context.Context, requestID string, db *postgres.DB) (Trace, er
 	}
 
 	if len(rows) == 0 {
-		return Trace{}, fmt.Errorf("request not found")
+		if store == nil {
+			return Trace{}, ErrTraceNotFound
+		}
+		record, err := archive.Lookup(ctx, db, store, reqUUID)
+		if errors.Is(err, archive.ErrNotArchived) {
+			return Trace{}, ErrTraceNotFound
+		}
+		if err != nil {
+			return Trace{}, fmt.Errorf("failed to read archived trace: %w", err)
+		}
+		return traceFromRecord(record)
 	}
 
 	// Create basic trace from first row
@@ -224,8 +307,15 @@ func GetTrace(ctx context.Context, requestID string, db *postgres.DB) (Trace, er
 		RequestID:         row.RequestID.String(),
 		UserID:            row.UserID.String(),
 		Model:             row.Model,
+		Alias:             row.Alias,
+		TargetURL:         row.TargetUrl,
 		Inputs:            inputs,
 		Response:          response,
+		PromptTokens:      int64(row.PromptTokens.Int32),
+		CompletionTokens:  int64(row.CompletionTokens.Int32),
+		CostUSD:           row.CostUsd.Float64,
+		CacheHit:          row.CacheHit.Bool,
+		CacheSimilarity:   row.CacheSimilarity.Float64,
 		RequestParameters: params,
 		ClientIP:          "", // Will be populated if client IP exists
 		RiskScore:         0,  // Will be populated if risk score exists
@@ -261,6 +351,8 @@ func GetTrace(ctx context.Context, requestID string, db *postgres.DB) (Trace, er
 				RequestID:     r.RequestID.String(),
 				FirewallID:    r.FirewallID.String,
 				FirewallType:  r.FirewallType.String,
+				Mode:          r.Mode.String,
+				Version:       r.FirewallVersion.Int32,
 				Blocked:       r.Blocked.Bool,
 				BlockedReason: r.BlockedReason.String,
 				RiskScore:     riskScore.Float64,
@@ -269,9 +361,55 @@ func GetTrace(ctx context.Context, requestID string, db *postgres.DB) (Trace, er
 	}
 	trace.FirewallInfo = events
 
+	// Add upstream attempts
+	attemptRows, err := db.Queries.ListUpstreamAttempts(ctx, reqUUID)
+	if err != nil {
+		return Trace{}, fmt.Errorf("failed to get upstream attempts: %w", err)
+	}
+
+	attempts := []Attempt{}
+	for _, a := range attemptRows {
+		attempts = append(attempts, Attempt{
+			RequestID:  a.RequestID.String(),
+			Attempt:    a.Attempt,
+			Model:      a.Model,
+			Provider:   a.Provider,
+			TargetURL:  a.TargetUrl,
+			StatusCode: int(a.StatusCode.Int32),
+			Error:      a.Error.String,
+			LatencyMs:  int64(a.LatencyMs.Int32),
+		})
+	}
+	trace.Attempts = attempts
+
 	return trace, nil
 }
 
+// GetFirewallStats counts evaluations and blocks per firewall and mode, so monitor-only
+// firewalls can be compared against enforcing ones before they are switched on
+func GetFirewallStats(ctx context.Context, db *postgres.DB) ([]FirewallStats, error) {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	rows, err := db.Queries.GetFirewallEventCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]FirewallStats, 0, len(rows))
+	for _, r := range rows {
+		stats = append(stats, FirewallStats{
+			FirewallID:   r.FirewallID,
+			FirewallType: r.FirewallType,
+			Mode:         r.Mode,
+			Total:        r.Total,
+			Blocked:      r.Blocked,
+		})
+	}
+
+	return stats, nil
+}
+
 // NewUUID generates a new UUID string
 func NewUUID() string {
 	return uuid.New().String()
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Backpressure is what the writer does with a record when its queue is full
+type Backpressure string
+
+const (
+	Block Backpressure = "block" // Wait for room, spooling the record if the request is cancelled first
+	Spool Backpressure = "spool" // Append the record to the spool file
+	Drop  Backpressure = "drop"  // Log and drop the record
+)
+
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = 200 * time.Millisecond
+	DefaultSpoolPath     = "audit-spool.jsonl"
+)
+
+// WriterConfig controls how audit records are queued and written to Postgres.
+// It is read once at startup.
+type WriterConfig struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Backpressure  Backpressure
+	SpoolPath     string // Records that couldn't be written, replayed once Postgres is back
+}
+
+type rawWriterConfig struct {
+	Audit struct {
+		QueueSize     int    `yaml:"queue_size"`
+		BatchSize     int    `yaml:"batch_size"`
+		FlushInterval string `yaml:"flush_interval"`
+		Backpressure  string `yaml:"backpressure"`
+		SpoolPath     string `yaml:"spool_path"`
+	} `yaml:"audit"`
+}
+
+// DefaultWriterConfig is used when config.yaml has no audit section
+func DefaultWriterConfig() WriterConfig {
+	return WriterConfig{
+		QueueSize:     DefaultQueueSize,
+		BatchSize:     DefaultBatchSize,
+		FlushInterval: DefaultFlushInterval,
+		Backpressure:  Block,
+		SpoolPath:     DefaultSpoolPath,
+	}
+}
+
+// ReadWriterConfig reads the audit section of a config file
+func ReadWriterConfig(path string) (WriterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WriterConfig{}, err
+	}
+
+	var raw rawWriterConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return WriterConfig{}, err
+	}
+
+	cfg := DefaultWriterConfig()
+
+	if raw.Audit.QueueSize < 0 || raw.Audit.BatchSize < 0 {
+		return WriterConfig{}, errors.New("audit: queue_size and batch_size cannot be negative")
+	}
+	if raw.Audit.QueueSize > 0 {
+		cfg.QueueSize = raw.Audit.QueueSize
+	}
+	if raw.Audit.BatchSize > 0 {
+		cfg.BatchSize = raw.Audit.BatchSize
+	}
+
+	if raw.Audit.FlushInterval != "" {
+		interval, err := time.ParseDuration(raw.Audit.FlushInterval)
+		if err != nil {
+			return WriterConfig{}, fmt.Errorf("audit: invalid flush_interval: %w", err)
+		}
+		if interval <= 0 {
+			return WriterConfig{}, errors.New("audit: flush_interval must be positive")
+		}
+		cfg.FlushInterval = interval
+	}
+
+	switch Backpressure(raw.Audit.Backpressure) {
+	case "":
+	case Block, Spool, Drop:
+		cfg.Backpressure = Backpressure(raw.Audit.Backpressure)
+	default:
+		return WriterConfig{}, fmt.Errorf("audit: unknown backpressure %q (expected block, spool or drop)", raw.Audit.Backpressure)
+	}
+
+	if raw.Audit.SpoolPath != "" {
+		cfg.SpoolPath = raw.Audit.SpoolPath
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,157 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+)
+
+// spool keeps audit records on local disk, one JSON record per line, while
+// Postgres can't take them. Records being replayed are moved to a separate
+// file, which is only removed once they are all written, so a crash during
+// a replay doesn't lose them. Records Postgres rejected outright are kept in
+// another file for someone to look at.
+type spool struct {
+	mu        sync.Mutex
+	path      string
+	replaying string
+	rejected  string
+}
+
+func newSpool(path string) *spool {
+	return &spool{path: path, replaying: path + ".replaying", rejected: path + ".rejected"}
+}
+
+// append adds records to the end of the spool and syncs them to disk
+func (s *spool) append(records []record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return appendRecords(s.path, records)
+}
+
+// reject sets a record aside in the rejected file
+func (s *spool) reject(rec record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return appendRecords(s.rejected, []record{rec})
+}
+
+// pending reports whether the spool has records to replay, including any
+// left by a replay that didn't finish
+func (s *spool) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return nonEmpty(s.path) || nonEmpty(s.replaying)
+}
+
+// take reads the records to replay. A replay that didn't finish is picked up
+// again; otherwise the spool is moved aside to be replayed. Either way the
+// records stay on disk until done or restore is called.
+func (s *spool) take() ([]record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !nonEmpty(s.replaying) {
+		if err := os.Rename(s.path, s.replaying); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return readRecords(s.replaying)
+}
+
+// done removes the records being replayed, once every one of them is written
+func (s *spool) done() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.replaying); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// restore puts records that couldn't be replayed back in front of any
+// spooled since they were taken, and ends the replay
+func (s *spool) restore(records []record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newer, err := readRecords(s.path)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := appendRecords(tmp, append(records, newer...)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	// A crash before this replays the restored records twice, which the
+	// writer skips as already written
+	if err := os.Remove(s.replaying); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func nonEmpty(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > 0
+}
+
+func appendRecords(path string, records []record) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func readRecords(path string) ([]record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A line cut short by a crash is skipped rather than blocking the rest
+			log.Printf("skipping unreadable audit spool line %d: %v", line, err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// ParseResponse turns a response body into what is stored in response_logs.
+// Streams are reassembled into the response they add up to, and bodies that
+// aren't JSON, such as an HTML error page from a load balancer, are kept as
+// raw text.
+func ParseResponse(body []byte, streaming bool) map[string]interface{} {
+	if streaming {
+		if response, ok := Reassemble(body); ok {
+			return response
+		}
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil || response == nil {
+		return map[string]interface{}{"raw": string(body)}
+	}
+	return response
+}
+
+type streamChunk struct {
+	ID       string          `json:"id"`
+	Object   string          `json:"object"`
+	Created  int64           `json:"created"`
+	Model    string          `json:"model"`
+	Type     string          `json:"type"`     // Responses API event type
+	Delta    json.RawMessage `json:"delta"`    // Responses API text delta
+	Response json.RawMessage `json:"response"` // Responses API final response
+	Choices  []struct {
+		Index        int     `json:"index"`
+		Text         string  `json:"text"` // Legacy completions
+		FinishReason *string `json:"finish_reason"`
+		Delta        struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage json.RawMessage `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// streamChoice is one choice put back together from its deltas
+type streamChoice struct {
+	role         string
+	content      strings.Builder
+	finishReason interface{}
+	toolCalls    map[int]*streamToolCall
+}
+
+type streamToolCall struct {
+	id        string
+	kind      string
+	name      string
+	arguments strings.Builder
+}
+
+// Reassemble rebuilds the response an OpenAI-format event stream adds up to:
+// a chat.completion or text_completion with the full message, finish reason
+// and usage, or for the Responses API the final response object. It returns
+// false when the body has no events.
+func Reassemble(body []byte) (map[string]interface{}, bool) {
+	var (
+		first        *streamChunk
+		object       string
+		choices      = map[int]*streamChoice{}
+		usage        json.RawMessage
+		final        json.RawMessage
+		text         strings.Builder
+		streamErrors []json.RawMessage
+		sawChunk     bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			continue
+		}
+
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			continue
+		}
+		sawChunk = true
+		if first == nil {
+			first = &chunk
+		}
+
+		if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+			streamErrors = append(streamErrors, chunk.Error)
+		}
+		if len(chunk.Usage) > 0 && string(chunk.Usage) != "null" {
+			usage = chunk.Usage
+		}
+
+		// Responses API events carry the whole response once it is done
+		if strings.HasPrefix(chunk.Type, "response.") {
+			if len(chunk.Response) > 0 {
+				final = chunk.Response
+			}
+			if chunk.Type == "response.output_text.delta" {
+				var delta string
+				if json.Unmarshal(chunk.Delta, &delta) == nil {
+					text.WriteString(delta)
+				}
+			}
+			continue
+		}
+
+		if chunk.Object != "" {
+			object = chunk.Object
+		}
+		for _, c := range chunk.Choices {
+			choice, ok := choices[c.Index]
+			if !ok {
+				choice = &streamChoice{toolCalls: map[int]*streamToolCall{}}
+				choices[c.Index] = choice
+			}
+			if c.Delta.Role != "" {
+				choice.role = c.Delta.Role
+			}
+			choice.content.WriteString(c.Delta.Content)
+			choice.content.WriteString(c.Text)
+			if c.FinishReason != nil {
+				choice.finishReason = *c.FinishReason
+			}
+			for _, tc := range c.Delta.ToolCalls {
+				call, ok := choice.toolCalls[tc.Index]
+				if !ok {
+					call = &streamToolCall{}
+					choice.toolCalls[tc.Index] = call
+				}
+				if tc.ID != "" {
+					call.id = tc.ID
+				}
+				if tc.Type != "" {
+					call.kind = tc.Type
+				}
+				if tc.Function.Name != "" {
+					call.name = tc.Function.Name
+				}
+				call.arguments.WriteString(tc.Function.Arguments)
+			}
+		}
+	}
+
+	if !sawChunk {
+		return nil, false
+	}
+
+	var response map[string]interface{}
+	switch {
+	case len(final) > 0:
+		json.Unmarshal(final, &response)
+	case text.Len() > 0:
+		// The stream ended before the response was done
+		response = map[string]interface{}{
+			"object":      "response",
+			"status":      "incomplete",
+			"output_text": text.String(),
+		}
+	}
+
+	if response == nil {
+		legacy := strings.HasPrefix(object, "text_completion")
+		response = map[string]interface{}{
+			"object":  "chat.completion",
+			"choices": reassembledChoices(choices, legacy),
+		}
+		if legacy {
+			response["object"] = "text_completion"
+		}
+		if first != nil {
+			response["id"] = first.ID
+			response["created"] = first.Created
+			response["model"] = first.Model
+		}
+	}
+
+	if _, ok := response["usage"]; !ok && len(usage) > 0 {
+		var u interface{}
+		if json.Unmarshal(usage, &u) == nil {
+			response["usage"] = u
+		}
+	}
+	if len(streamErrors) > 0 {
+		var e interface{}
+		if json.Unmarshal(streamErrors[len(streamErrors)-1], &e) == nil {
+			response["error"] = e
+		}
+	}
+
+	return response, true
+}
+
+// reassembledChoices orders the choices and turns each into a message, or for
+// legacy completions into text
+func reassembledChoices(choices map[int]*streamChoice, legacy bool) []interface{} {
+	indexes := make([]int, 0, len(choices))
+	for i := range choices {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	out := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		choice := choices[i]
+		entry := map[string]interface{}{
+			"index":         i,
+			"finish_reason": choice.finishReason,
+		}
+
+		if legacy {
+			entry["text"] = choice.content.String()
+			out = append(out, entry)
+			continue
+		}
+
+		role := choice.role
+		if role == "" {
+			role = "assistant"
+		}
+		message := map[string]interface{}{
+			"role":    role,
+			"content": choice.content.String(),
+		}
+		if len(choice.toolCalls) > 0 {
+			message["tool_calls"] = reassembledToolCalls(choice.toolCalls)
+		}
+		entry["message"] = message
+		out = append(out, entry)
+	}
+
+	return out
+}
+
+func reassembledToolCalls(calls map[int]*streamToolCall) []interface{} {
+	indexes := make([]int, 0, len(calls))
+	for i := range calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	out := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		call := calls[i]
+		kind := call.kind
+		if kind == "" {
+			kind = "function"
+		}
+		out = append(out, map[string]interface{}{
+			"id":   call.id,
+			"type": kind,
+			"function": map[string]interface{}{
+				"name":      call.name,
+				"arguments": call.arguments.String(),
+			},
+		})
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// normalize round-trips a value through JSON, so numbers compare as float64
+func normalize(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestReassemble(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   string // JSON, empty when nothing is reassembled
+		wantOK bool
+	}{
+		{
+			name: "chat",
+			body: `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: [DONE]
+`,
+			want: `{"id":"chatcmpl-1","object":"chat.completion","created":1700000000,"model":"gpt-4o",
+				"choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"Hello"}}],
+				"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+			wantOK: true,
+		},
+		{
+			name: "chat with tool calls",
+			body: `data: {"id":"chatcmpl-2","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"ci"}}]}}]}
+data: {"id":"chatcmpl-2","object":"chat.completion.chunk","created":1,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Oslo\"}"}}]},"finish_reason":"tool_calls"}]}
+data: [DONE]
+`,
+			want: `{"id":"chatcmpl-2","object":"chat.completion","created":1,"model":"gpt-4o",
+				"choices":[{"index":0,"finish_reason":"tool_calls","message":{"role":"assistant","content":"",
+					"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}}]}}]}`,
+			wantOK: true,
+		},
+		{
+			name: "legacy completions",
+			body: `data: {"id":"cmpl-1","object":"text_completion","created":2,"model":"gpt-3.5-turbo-instruct","choices":[{"index":1,"text":"B"}]}
+data: {"id":"cmpl-1","object":"text_completion","created":2,"model":"gpt-3.5-turbo-instruct","choices":[{"index":0,"text":"A","finish_reason":"length"}]}
+data: {"id":"cmpl-1","object":"text_completion","created":2,"model":"gpt-3.5-turbo-instruct","choices":[{"index":1,"text":"b","finish_reason":"stop"}]}
+data: [DONE]
+`,
+			want: `{"id":"cmpl-1","object":"text_completion","created":2,"model":"gpt-3.5-turbo-instruct",
+				"choices":[{"index":0,"finish_reason":"length","text":"A"},{"index":1,"finish_reason":"stop","text":"Bb"}]}`,
+			wantOK: true,
+		},
+		{
+			name: "responses",
+			body: `event: response.output_text.delta
+data: {"type":"response.output_text.delta","delta":"Hi"}
+
+event: response.completed
+data: {"type":"response.completed","response":{"id":"resp_1","object":"response","status":"completed","output_text":"Hi","usage":{"input_tokens":3,"output_tokens":1}}}
+`,
+			want:   `{"id":"resp_1","object":"response","status":"completed","output_text":"Hi","usage":{"input_tokens":3,"output_tokens":1}}`,
+			wantOK: true,
+		},
+		{
+			name: "responses cut short",
+			body: `data: {"type":"response.output_text.delta","delta":"Hel"}
+data: {"type":"response.output_text.delta","delta":"lo"}
+`,
+			want:   `{"object":"response","status":"incomplete","output_text":"Hello"}`,
+			wantOK: true,
+		},
+		{
+			name: "error mid-stream",
+			body: `data: {"id":"chatcmpl-3","object":"chat.completion.chunk","created":3,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hi"}}]}
+data: {"error":{"message":"overloaded","type":"server_error"}}
+`,
+			want: `{"id":"chatcmpl-3","object":"chat.completion","created":3,"model":"gpt-4o",
+				"choices":[{"index":0,"finish_reason":null,"message":{"role":"assistant","content":"Hi"}}],
+				"error":{"message":"overloaded","type":"server_error"}}`,
+			wantOK: true,
+		},
+		{name: "no events", body: `{"error":{"message":"bad request"}}`},
+		{name: "empty", body: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Reassemble([]byte(tt.body))
+			if ok != tt.wantOK {
+				t.Fatalf("Reassemble() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := normalize(t, got); !reflect.DeepEqual(got, want) {
+				t.Errorf("Reassemble() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		streaming bool
+		want      string
+	}{
+		{"json", `{"id":"chatcmpl-1","object":"chat.completion"}`, false, `{"id":"chatcmpl-1","object":"chat.completion"}`},
+		{"not json", `<html>502 Bad Gateway</html>`, false, `{"raw":"<html>502 Bad Gateway</html>"}`},
+		{"json array", `[1,2]`, false, `{"raw":"[1,2]"}`},
+		{"error instead of a stream", `{"error":{"message":"bad request"}}`, true, `{"error":{"message":"bad request"}}`},
+		{"stream", `data: {"type":"response.completed","response":{"id":"resp_1"}}`, true, `{"id":"resp_1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := normalize(t, ParseResponse([]byte(tt.body), tt.streaming)); !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseResponse() = %v, want %v", got, want)
+			}
+		})
+	}
+}
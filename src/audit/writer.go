@@ -0,0 +1,345 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+)
+
+const (
+	// How often the spool is replayed while it has records
+	replayInterval = 10 * time.Second
+	// How long one batch may take to write
+	flushTimeout = 30 * time.Second
+)
+
+// record is one queued audit row. Exactly one field is set. Rows are built
+// when they are queued, so they can be spooled as they will be written.
+type record struct {
+	Request       *sqlc.InsertRequestLogsParams      `json:"request,omitempty"`
+	Response      *sqlc.InsertResponseLogsParams     `json:"response,omitempty"`
+	FirewallEvent *sqlc.InsertFirewallEventsParams   `json:"firewall_event,omitempty"`
+	Attempt       *sqlc.InsertUpstreamAttemptsParams `json:"attempt,omitempty"`
+}
+
+// Writer writes audit records to Postgres in the background. Records are
+// queued by the request path and written in batches with COPY. When Postgres
+// can't be reached, batches go to a local spool file and are replayed once it
+// is back.
+type Writer struct {
+	db      *postgres.DB
+	cfg     WriterConfig
+	queue   chan record
+	done    chan struct{}
+	spool   *spool
+	dropped atomic.Int64
+
+	// Held for reading while queueing, so Close can't close the queue under a sender
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWriter starts a writer. Records spooled by a previous run are replayed first.
+func NewWriter(db *postgres.DB, cfg WriterConfig) *Writer {
+	w := &Writer{
+		db:    db,
+		cfg:   cfg,
+		queue: make(chan record, cfg.QueueSize),
+		done:  make(chan struct{}),
+		spool: newSpool(cfg.SpoolPath),
+	}
+	go w.run()
+	return w
+}
+
+// LogRequest queues a request log entry and returns the ID it will be stored under
+func (w *Writer) LogRequest(ctx context.Context, r Request) (string, error) {
+	requestID := NewUUID()
+	row, err := requestRow(r, requestID, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return requestID, w.enqueue(ctx, record{Request: &row})
+}
+
+// LogResponse queues the response to a request
+func (w *Writer) LogResponse(ctx context.Context, r Response) error {
+	row, err := responseRow(r, time.Now())
+	if err != nil {
+		return err
+	}
+	return w.enqueue(ctx, record{Response: &row})
+}
+
+// LogFirewallEvent queues a firewall's verdict on a request
+func (w *Writer) LogFirewallEvent(ctx context.Context, fe FirewallEvent) error {
+	row, err := firewallEventRow(fe, time.Now())
+	if err != nil {
+		return err
+	}
+	return w.enqueue(ctx, record{FirewallEvent: &row})
+}
+
+// LogAttempt queues one upstream call made for a request
+func (w *Writer) LogAttempt(ctx context.Context, a Attempt) error {
+	row := attemptRow(a, time.Now())
+	return w.enqueue(ctx, record{Attempt: &row})
+}
+
+// Close stops accepting records and waits for the queue to be written.
+// Records that arrive afterwards are spooled.
+func (w *Writer) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Writer) enqueue(ctx context.Context, rec record) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return w.spool.append([]record{rec})
+	}
+
+	select {
+	case w.queue <- rec:
+		return nil
+	default:
+	}
+
+	// The queue is full
+	switch w.cfg.Backpressure {
+	case Drop:
+		log.Printf("audit queue full, dropped a record (%d dropped so far)", w.dropped.Add(1))
+		return nil
+	case Spool:
+		return w.spool.append([]record{rec})
+	default:
+		select {
+		case w.queue <- rec:
+			return nil
+		case <-ctx.Done():
+			return w.spool.append([]record{rec})
+		}
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	w.replay()
+
+	flush := time.NewTicker(w.cfg.FlushInterval)
+	defer flush.Stop()
+	replay := time.NewTicker(replayInterval)
+	defer replay.Stop()
+
+	batch := make([]record, 0, w.cfg.BatchSize)
+	for {
+		select {
+		case rec, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= w.cfg.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-flush.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-replay.C:
+			w.replay()
+		}
+	}
+}
+
+// flush writes a batch. While the spool has records, batches are added to it
+// instead, so rows are written after the requests they belong to.
+func (w *Writer) flush(batch []record) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if w.spool.pending() {
+		if err := w.spool.append(batch); err != nil {
+			log.Printf("failed to spool %d audit records: %v", len(batch), err)
+		}
+		return
+	}
+
+	if err := w.write(batch); err != nil {
+		log.Printf("failed to write %d audit records: %v", len(batch), err)
+		if err := w.spool.append(batch); err != nil {
+			log.Printf("failed to spool %d audit records: %v", len(batch), err)
+		}
+	}
+}
+
+// write inserts a batch. If Postgres is reachable but the batch is rejected,
+// each row is written on its own so one bad row doesn't lose the rest, and
+// rows that still fail are set aside in the rejected file.
+func (w *Writer) write(batch []record) error {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	err := w.insert(ctx, batch)
+	if err == nil {
+		return nil
+	}
+	if pingErr := w.db.Pool.Ping(ctx); pingErr != nil {
+		return err
+	}
+
+	log.Printf("audit batch rejected, writing rows one at a time: %v", err)
+	for _, rec := range inOrder(batch) {
+		err := w.insert(ctx, []record{rec})
+		if err == nil || alreadyWritten(err) {
+			continue
+		}
+		log.Printf("audit record rejected: %v", err)
+		if err := w.spool.reject(rec); err != nil {
+			log.Printf("failed to set aside rejected audit record: %v", err)
+		}
+	}
+	return nil
+}
+
+// insert copies a batch into each table in one transaction, requests first
+func (w *Writer) insert(ctx context.Context, batch []record) error {
+	var (
+		requests  []sqlc.InsertRequestLogsParams
+		responses []sqlc.InsertResponseLogsParams
+		events    []sqlc.InsertFirewallEventsParams
+		attempts  []sqlc.InsertUpstreamAttemptsParams
+	)
+	for _, rec := range batch {
+		switch {
+		case rec.Request != nil:
+			requests = append(requests, *rec.Request)
+		case rec.Response != nil:
+			responses = append(responses, *rec.Response)
+		case rec.FirewallEvent != nil:
+			events = append(events, *rec.FirewallEvent)
+		case rec.Attempt != nil:
+			attempts = append(attempts, *rec.Attempt)
+		}
+	}
+
+	tx, err := w.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	q := w.db.Queries.WithTx(tx)
+
+	if len(requests) > 0 {
+		if _, err := q.InsertRequestLogs(ctx, requests); err != nil {
+			return err
+		}
+	}
+	if len(responses) > 0 {
+		if _, err := q.InsertResponseLogs(ctx, responses); err != nil {
+			return err
+		}
+	}
+	if len(events) > 0 {
+		if _, err := q.InsertFirewallEvents(ctx, events); err != nil {
+			return err
+		}
+	}
+	if len(attempts) > 0 {
+		if _, err := q.InsertUpstreamAttempts(ctx, attempts); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// replay writes the spooled records once Postgres is reachable. Requests are
+// written before everything else, as the other rows reference them. Rows
+// carry their IDs, so those written before an interrupted replay are skipped
+// when it is picked up again.
+func (w *Writer) replay() {
+	if !w.spool.pending() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	err := w.db.Pool.Ping(ctx)
+	cancel()
+	if err != nil {
+		return
+	}
+
+	records, err := w.spool.take()
+	if err != nil {
+		log.Printf("failed to read audit spool: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		if err := w.spool.done(); err != nil {
+			log.Printf("failed to remove replayed audit spool: %v", err)
+		}
+		return
+	}
+
+	ordered := inOrder(records)
+	for start := 0; start < len(ordered); start += w.cfg.BatchSize {
+		end := min(start+w.cfg.BatchSize, len(ordered))
+		if err := w.write(ordered[start:end]); err != nil {
+			log.Printf("audit spool replay stopped: %v", err)
+			if err := w.spool.restore(ordered[start:]); err != nil {
+				log.Printf("failed to restore audit spool: %v", err)
+			}
+			return
+		}
+	}
+
+	if err := w.spool.done(); err != nil {
+		log.Printf("failed to remove replayed audit spool: %v", err)
+	}
+	log.Printf("replayed %d spooled audit records", len(records))
+}
+
+// inOrder returns the records with requests first, otherwise keeping their order
+func inOrder(records []record) []record {
+	ordered := make([]record, len(records))
+	copy(ordered, records)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Request != nil && ordered[j].Request == nil
+	})
+	return ordered
+}
+
+// alreadyWritten reports whether a row failed because its ID was written
+// before, as happens when a replay is interrupted
+func alreadyWritten(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"covalence/src/request"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Header is set on responses to hit or miss, and read from requests:
+// "true" opts a request in, "bypass" skips the cache entirely
+const Header = "X-Covalence-Cache"
+
+// SimilarityHeader is set on semantic cache hits to how close the prompts were
+const SimilarityHeader = "X-Covalence-Cache-Similarity"
+
+const (
+	Hit    = "hit"
+	Miss   = "miss"
+	OptIn  = "true"
+	Bypass = "bypass"
+)
+
+// Entry is a cached response body
+type Entry struct {
+	Model       string
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Cache serves repeated deterministic requests without calling the provider
+type Cache struct {
+	memory   *lru
+	semantic *semanticIndex
+	db       *postgres.DB
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+// New creates an empty cache. The database is only used when the config is shared.
+func New(db *postgres.DB) *Cache {
+	return &Cache{memory: newLRU(), semantic: &semanticIndex{}, db: db}
+}
+
+// Key hashes the request as it would be sent upstream, after the firewalls
+// have run, along with the API key that sent it, so responses are never
+// served to another tenant. JSON objects are marshalled with sorted keys, so
+// equal requests hash the same whatever order the client sent their
+// parameters in.
+func Key(g request.Generate) (string, error) {
+	body, err := json.Marshal(g.ToMap())
+	if err != nil {
+		return "", err
+	}
+	return requestHash(g, body), nil
+}
+
+func requestHash(g request.Generate, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(g.User.APIKeyID.String()))
+	hash.Write([]byte{'\n'})
+	hash.Write([]byte(g.TargetURL.String()))
+	hash.Write([]byte{'\n'})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Cacheable reports whether a request's response may be served from or
+// stored in the cache: its alias must have caching enabled, and it must ask
+// for temperature 0 or opt in with the header
+func Cacheable(cfg Config, g request.Generate, h http.Header) bool {
+	if !cfg.Enabled(g.Model.Name.String()) || Bypassed(h) {
+		return false
+	}
+
+	if strings.ToLower(h.Get(Header)) == OptIn {
+		return true
+	}
+
+	return g.Temperature != nil && g.Temperature.Float32() == 0
+}
+
+// SemanticCacheable reports whether a request may be answered with the
+// response to a paraphrase of it. Enabling it for an alias is the opt-in.
+func SemanticCacheable(cfg Config, g request.Generate, h http.Header) bool {
+	return cfg.SemanticEnabled(g.Model.Name.String()) && !Bypassed(h)
+}
+
+// Bypassed reports whether the client asked not to use the cache
+func Bypassed(h http.Header) bool {
+	return strings.ToLower(h.Get(Header)) == Bypass
+}
+
+// Get looks the key up in memory, then in Postgres when shared
+func (c *Cache) Get(ctx context.Context, cfg Config, key string) (Entry, bool, error) {
+	now := time.Now()
+	if entry, hit := c.memory.get(key, now); hit {
+		return entry, true, nil
+	}
+
+	if !cfg.Shared {
+		return Entry{}, false, nil
+	}
+
+	row, err := c.db.Queries.GetCachedResponse(ctx, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	entry := Entry{
+		Model:       row.Model,
+		ContentType: row.ContentType,
+		Body:        row.Body,
+		ExpiresAt:   row.ExpiresAt.Time,
+	}
+	c.memory.put(key, entry, cfg.MaxEntries)
+
+	return entry, true, nil
+}
+
+// Put stores a response for the configured TTL
+func (c *Cache) Put(ctx context.Context, cfg Config, key string, entry Entry) error {
+	entry.ExpiresAt = time.Now().Add(cfg.TTL)
+	c.memory.put(key, entry, cfg.MaxEntries)
+
+	if !cfg.Shared {
+		return nil
+	}
+
+	c.prune(ctx)
+
+	return c.db.Queries.PutCachedResponse(ctx, sqlc.PutCachedResponseParams{
+		CacheKey:    key,
+		Model:       entry.Model,
+		ContentType: entry.ContentType,
+		Body:        entry.Body,
+		ExpiresAt:   pgtype.Timestamptz{Time: entry.ExpiresAt, Valid: true},
+	})
+}
+
+// prune deletes expired responses from Postgres, at most once a minute per instance
+func (c *Cache) prune(ctx context.Context) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if now.Sub(c.lastPruned) < time.Minute {
+		c.mu.Unlock()
+		return
+	}
+	c.lastPruned = now
+	c.mu.Unlock()
+
+	c.db.Queries.DeleteExpiredCachedResponses(ctx)
+}
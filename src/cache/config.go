@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"covalence/src/internal"
+	"covalence/src/types"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Wildcard enables caching for every model alias
+const Wildcard = "*"
+
+const (
+	DefaultTTL               = time.Hour
+	DefaultMaxEntries        = 1000
+	DefaultSemanticThreshold = 0.95
+)
+
+// Config controls which responses are cached and for how long. The zero value caches nothing.
+type Config struct {
+	TTL        time.Duration
+	MaxEntries int             // Entries kept in memory per instance
+	Shared     bool            // Also store responses in Postgres so instances share them
+	Models     map[string]bool // Aliases with caching enabled, or * for all of them
+	Semantic   SemanticConfig
+}
+
+// SemanticConfig controls the cache that matches paraphrased prompts. It keeps
+// the same TTL and number of entries as the exact cache, in memory only.
+type SemanticConfig struct {
+	Model     internal.Model  // Embedding model run by the internal model service
+	Threshold float64         // Minimum cosine similarity to serve a cached response
+	Models    map[string]bool // Aliases with semantic caching enabled, or * for all of them
+}
+
+type rawConfig struct {
+	Cache struct {
+		TTL        string   `yaml:"ttl"`
+		MaxEntries int      `yaml:"max_entries"`
+		Shared     bool     `yaml:"shared"`
+		Models     []string `yaml:"models"`
+		Semantic   struct {
+			Model     string   `yaml:"model"`
+			Threshold float64  `yaml:"threshold"`
+			Models    []string `yaml:"models"`
+		} `yaml:"semantic"`
+	} `yaml:"cache"`
+}
+
+// ReadConfig reads the cache section of a config file. The semantic cache's
+// model must be one of the given internal models.
+func ReadConfig(path string, models []internal.Model) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var raw rawConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{
+		TTL:        DefaultTTL,
+		MaxEntries: DefaultMaxEntries,
+		Shared:     raw.Cache.Shared,
+		Models:     make(map[string]bool),
+	}
+
+	if raw.Cache.TTL != "" {
+		ttl, err := time.ParseDuration(raw.Cache.TTL)
+		if err != nil {
+			return Config{}, fmt.Errorf("cache: invalid ttl: %w", err)
+		}
+		if ttl <= 0 {
+			return Config{}, errors.New("cache: ttl must be positive")
+		}
+		cfg.TTL = ttl
+	}
+
+	if raw.Cache.MaxEntries < 0 {
+		return Config{}, errors.New("cache: max_entries cannot be negative")
+	}
+	if raw.Cache.MaxEntries > 0 {
+		cfg.MaxEntries = raw.Cache.MaxEntries
+	}
+
+	for _, model := range raw.Cache.Models {
+		if model == "" {
+			return Config{}, errors.New("cache: model alias cannot be empty")
+		}
+		cfg.Models[model] = true
+	}
+
+	semantic, err := parseSemantic(raw.Cache.Semantic.Model, raw.Cache.Semantic.Threshold, raw.Cache.Semantic.Models, models)
+	if err != nil {
+		return Config{}, fmt.Errorf("cache: semantic: %w", err)
+	}
+	cfg.Semantic = semantic
+
+	return cfg, nil
+}
+
+func parseSemantic(model string, threshold float64, aliases []string, models []internal.Model) (SemanticConfig, error) {
+	semantic := SemanticConfig{Threshold: DefaultSemanticThreshold, Models: make(map[string]bool)}
+	if len(aliases) == 0 {
+		return semantic, nil
+	}
+
+	modelID, err := types.NewModelID(model)
+	if err != nil {
+		return SemanticConfig{}, err
+	}
+	semantic.Model, err = internal.FindModel(models, modelID)
+	if err != nil {
+		return SemanticConfig{}, fmt.Errorf("model %s is not in the models file", model)
+	}
+	if semantic.Model.Type.String() != "embedding" {
+		return SemanticConfig{}, fmt.Errorf("model %s is not an embedding model", model)
+	}
+
+	if threshold < 0 || threshold > 1 {
+		return SemanticConfig{}, errors.New("threshold must be between 0 and 1")
+	}
+	if threshold > 0 {
+		semantic.Threshold = threshold
+	}
+
+	for _, alias := range aliases {
+		if alias == "" {
+			return SemanticConfig{}, errors.New("model alias cannot be empty")
+		}
+		semantic.Models[alias] = true
+	}
+
+	return semantic, nil
+}
+
+// Enabled reports whether responses for a model alias may be cached
+func (c Config) Enabled(alias string) bool {
+	return c.Models[alias] || c.Models[Wildcard]
+}
+
+// SemanticEnabled reports whether a model alias may be served paraphrased prompts' responses
+func (c Config) SemanticEnabled(alias string) bool {
+	return c.Semantic.Models[alias] || c.Semantic.Models[Wildcard]
+}
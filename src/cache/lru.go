@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru keeps the most recently used entries in memory, up to a capacity
+type lru struct {
+	mu      sync.Mutex
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry Entry
+}
+
+func newLRU() *lru {
+	return &lru{order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (l *lru) get(key string, now time.Time) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elem, exists := l.entries[key]
+	if !exists {
+		return Entry{}, false
+	}
+
+	item := elem.Value.(*lruItem)
+	if !now.Before(item.entry.ExpiresAt) {
+		l.order.Remove(elem)
+		delete(l.entries, key)
+		return Entry{}, false
+	}
+
+	l.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+// put adds or replaces an entry, then evicts the least recently used ones over capacity
+func (l *lru) put(key string, entry Entry, capacity int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, exists := l.entries[key]; exists {
+		elem.Value.(*lruItem).entry = entry
+		l.order.MoveToFront(elem)
+	} else {
+		l.entries[key] = l.order.PushFront(&lruItem{key: key, entry: entry})
+	}
+
+	// The capacity comes from config, so it can shrink on reload
+	for l.order.Len() > capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruItem).key)
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"covalence/src/internal/embedding"
+	"covalence/src/request"
+	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Prompt is a request's last user message embedded, along with a hash of
+// everything else in the request. Only prompts with the same scope are compared.
+type Prompt struct {
+	Scope     string
+	Embedding []float32
+}
+
+// semanticIndex keeps embedded prompts in memory and searches them linearly
+type semanticIndex struct {
+	mu      sync.Mutex
+	entries []semanticEntry // Oldest first
+}
+
+type semanticEntry struct {
+	prompt Prompt
+	norm   float64
+	entry  Entry
+}
+
+// EmbedPrompt embeds the request's last user message with the configured model
+func EmbedPrompt(cfg Config, g request.Generate) (Prompt, error) {
+	last := -1
+	for i, msg := range g.Messages {
+		if msg.Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return Prompt{}, errors.New("request has no user message")
+	}
+
+	// The scope is the request without the message being matched, so a
+	// paraphrase only matches under the same API key, model, history and
+	// parameters
+	scoped := g
+	scoped.Messages = append(g.Messages[:last:last], g.Messages[last+1:]...)
+	body, err := json.Marshal(scoped.ToMap())
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	req, err := embedding.NewRequest(cfg.Semantic.Model, g.Messages[last].Content)
+	if err != nil {
+		return Prompt{}, err
+	}
+	resp, err := req.Run()
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	return Prompt{Scope: requestHash(scoped, body), Embedding: resp.Embedding}, nil
+}
+
+// GetSimilar returns the cached response whose prompt is most similar to this
+// one, if it is at least as similar as the threshold
+func (c *Cache) GetSimilar(cfg Config, p Prompt) (Entry, float64, bool) {
+	c.semantic.mu.Lock()
+	defer c.semantic.mu.Unlock()
+
+	now := time.Now()
+	norm := magnitude(p.Embedding)
+	best, bestSimilarity := -1, cfg.Semantic.Threshold
+
+	live := c.semantic.entries[:0]
+	for _, se := range c.semantic.entries {
+		if !now.Before(se.entry.ExpiresAt) {
+			continue
+		}
+		live = append(live, se)
+
+		if se.prompt.Scope != p.Scope || len(se.prompt.Embedding) != len(p.Embedding) {
+			continue
+		}
+		if similarity := cosine(se.prompt.Embedding, p.Embedding, se.norm, norm); similarity >= bestSimilarity {
+			best, bestSimilarity = len(live)-1, similarity
+		}
+	}
+	c.semantic.entries = live
+
+	if best < 0 {
+		return Entry{}, 0, false
+	}
+	return live[best].entry, bestSimilarity, true
+}
+
+// PutSimilar stores a response under its prompt's embedding for the configured
+// TTL, dropping the oldest entries over the configured number
+func (c *Cache) PutSimilar(cfg Config, p Prompt, entry Entry) {
+	entry.ExpiresAt = time.Now().Add(cfg.TTL)
+
+	c.semantic.mu.Lock()
+	defer c.semantic.mu.Unlock()
+
+	c.semantic.entries = append(c.semantic.entries, semanticEntry{prompt: p, norm: magnitude(p.Embedding), entry: entry})
+	if over := len(c.semantic.entries) - cfg.MaxEntries; over > 0 {
+		c.semantic.entries = append([]semanticEntry(nil), c.semantic.entries[over:]...)
+	}
+}
+
+func magnitude(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+func cosine(a, b []float32, normA, normB float64) float64 {
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot / (normA * normB)
+}
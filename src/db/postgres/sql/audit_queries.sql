@@ -1,29 +1,40 @@
--- name: InsertRequestLog :one
+-- Audit rows are written in batches by the audit writer, which sets the
+-- request ID and timestamps when the row is queued
+
+-- name: InsertRequestLogs :copyfrom
 INSERT INTO request_logs (
-  user_id, api_key_id, model, target_url, inputs, parameters, client_ip
+  request_id, user_id, api_key_id, model, target_url, inputs, parameters, client_ip, alias, received_at
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING *;
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
 
--- name: InsertResponseLog :one
+-- name: InsertResponseLogs :copyfrom
 INSERT INTO response_logs (
-  request_id, response, latency_ms
+  response_id, request_id, response, latency_ms, prompt_tokens, completion_tokens, cost_usd, cache_hit, cache_similarity, created_at
 )
-VALUES ($1, $2, $3)
-RETURNING *;
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
 
--- name: InsertFirewallEvent :one
+-- name: InsertFirewallEvents :copyfrom
 INSERT INTO firewall_events (
-  request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score
+  firewall_event_id, request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score, mode, firewall_version, evaluated_at
 )
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING *;
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: InsertUpstreamAttempts :copyfrom
+INSERT INTO upstream_attempts (
+  attempt_id, request_id, attempt, model, provider, target_url, status_code, error, latency_ms, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: ListUpstreamAttempts :many
+SELECT * FROM upstream_attempts
+WHERE request_id = $1
+ORDER BY attempt;
 
 -- name: InsertAuditArchive :one
 INSERT INTO audit_archives (
-  request_id, s3_path, archive_hash
+  request_id, s3_path, archive_hash, received_at
 )
-VALUES ($1, $2, $3)
+VALUES ($1, $2, $3, $4)
 RETURNING *;
 
 -- name: MarkRequestArchived :exec
@@ -32,13 +43,127 @@ SET archived = TRUE
 WHERE request_id = $1;
 
 -- name: GetUnarchivedRequests :many
+-- Locks the requests it returns, so instances don't archive the same ones
 SELECT * FROM request_logs
 WHERE archived = FALSE
-AND received_at < now() - interval '10 minutes';
+AND received_at < now() - interval '10 minutes'
+ORDER BY received_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: ListResponseLogsForRequests :many
+SELECT * FROM response_logs
+WHERE request_id = ANY($1::uuid[])
+ORDER BY created_at;
+
+-- name: ListFirewallEventsForRequests :many
+SELECT * FROM firewall_events
+WHERE request_id = ANY($1::uuid[])
+ORDER BY evaluated_at;
+
+-- name: ListUpstreamAttemptsForRequests :many
+SELECT * FROM upstream_attempts
+WHERE request_id = ANY($1::uuid[])
+ORDER BY request_id, attempt;
+
+-- name: DeleteArchivedRequestsBefore :execrows
+-- Restored requests are kept until they were restored before the cutoff too
+DELETE FROM request_logs
+WHERE archived = TRUE
+AND received_at < $1
+AND (restored_at IS NULL OR restored_at < $1);
+
+-- name: GetAuditArchiveForRequest :one
+SELECT * FROM audit_archives
+WHERE request_id = $1
+ORDER BY archived_at DESC
+LIMIT 1;
+
+-- name: ListAuditArchivesReceivedBetween :many
+-- Archive objects holding requests received in [$1, $2)
+SELECT s3_path, archive_hash
+FROM audit_archives
+WHERE received_at >= $1 AND received_at < $2
+GROUP BY s3_path, archive_hash
+ORDER BY MIN(received_at);
+
+-- name: ListExistingRequests :many
+SELECT request_id FROM request_logs
+WHERE request_id = ANY($1::uuid[]);
+
+-- name: RestoreRequestLogs :copyfrom
+-- Restored rows keep their IDs and audit chain links
+INSERT INTO request_logs (
+  request_id, user_id, api_key_id, model, target_url, inputs, parameters, received_at, client_ip, archived, alias,
+  chain_seq, prev_hash, row_hash, restored_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);
+
+-- name: RestoreResponseLogs :copyfrom
+INSERT INTO response_logs (
+  response_id, request_id, response, created_at, latency_ms, prompt_tokens, completion_tokens, cost_usd, cache_hit, cache_similarity,
+  chain_seq, prev_hash, row_hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+
+-- name: RestoreFirewallEvents :copyfrom
+INSERT INTO firewall_events (
+  firewall_event_id, request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score, evaluated_at, mode, firewall_version,
+  chain_seq, prev_hash, row_hash
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
+
+-- name: RestoreUpstreamAttempts :copyfrom
+INSERT INTO upstream_attempts (
+  attempt_id, request_id, attempt, model, provider, target_url, status_code, error, latency_ms, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: GetAuditChainHead :one
+SELECT * FROM audit_chain_head;
+
+-- name: ListAuditChainLinks :many
+-- Links with after < chain_seq <= through. A link that was archived but not
+-- yet pruned is listed twice.
+SELECT chain_seq, table_name, prev_hash, row_hash, computed_hash
+FROM audit_chain_links
+WHERE chain_seq > $1 AND chain_seq <= $2
+ORDER BY chain_seq;
+
+-- name: ListBrokenLinksForRequests :many
+-- Links recorded for the requests whose content no longer matches their hash
+-- or whose previous hash doesn't match the link before them
+SELECT COALESCE(l.chain_seq, 0)::bigint AS chain_seq, l.table_name
+FROM audit_chain_links l
+LEFT JOIN LATERAL (
+  SELECT p.row_hash FROM audit_chain_links p
+  WHERE p.chain_seq = l.chain_seq - 1
+  LIMIT 1
+) prev ON TRUE
+WHERE l.request_id = ANY($1::uuid[])
+AND (l.row_hash = ''
+  OR l.computed_hash <> l.row_hash
+  OR l.prev_hash IS DISTINCT FROM COALESCE(prev.row_hash, CASE WHEN l.chain_seq = 1 THEN '' END))
+ORDER BY l.chain_seq;
+
+-- name: InsertArchivedLinksForRequests :exec
+INSERT INTO audit_archived_links (chain_seq, table_name, prev_hash, row_hash, s3_path)
+SELECT chain_seq, table_name, prev_hash, row_hash, $2
+FROM audit_chain_links
+WHERE request_id = ANY($1::uuid[])
+ON CONFLICT (chain_seq) DO NOTHING;
 
 -- name: GetRequestFullTrace :many
-SELECT rl.*, res.response, res.latency_ms, pe.*
+SELECT rl.*, res.response, res.latency_ms, res.prompt_tokens, res.completion_tokens, res.cost_usd, res.cache_hit, res.cache_similarity, pe.*
 FROM request_logs rl
 LEFT JOIN response_logs res ON rl.request_id = res.request_id
 LEFT JOIN firewall_events pe ON rl.request_id = pe.request_id
 WHERE rl.request_id = $1;
+
+-- name: GetFirewallEventCounts :many
+SELECT firewall_id, firewall_type, mode,
+  COUNT(*) AS total,
+  COUNT(*) FILTER (WHERE blocked) AS blocked
+FROM firewall_events
+GROUP BY firewall_id, firewall_type, mode
+ORDER BY firewall_id, mode;
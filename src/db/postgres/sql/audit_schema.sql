@@ -13,7 +13,12 @@ CREATE TABLE request_logs (
     parameters JSONB,
     received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
     client_ip INET,
-    archived BOOLEAN DEFAULT FALSE
+    archived BOOLEAN DEFAULT FALSE,
+    alias TEXT NOT NULL DEFAULT '',
+    chain_seq BIGINT, -- Position in the audit hash chain, set by audit_chain_link
+    prev_hash TEXT,
+    row_hash TEXT,
+    restored_at TIMESTAMPTZ -- Set when the request is restored from its archive
 );
 
 CREATE TABLE response_logs (
@@ -21,7 +26,15 @@ CREATE TABLE response_logs (
     request_id UUID REFERENCES request_logs(request_id) ON DELETE CASCADE,
     response JSONB NOT NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
-    latency_ms INTEGER
+    latency_ms INTEGER,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+    cache_similarity DOUBLE PRECISION, -- Set for semantic cache hits
+    chain_seq BIGINT, -- Position in the audit hash chain, set by audit_chain_link
+    prev_hash TEXT,
+    row_hash TEXT
 );
 
 CREATE TABLE firewall_events (
@@ -32,19 +45,132 @@ CREATE TABLE firewall_events (
     blocked BOOLEAN DEFAULT FALSE,
     blocked_reason TEXT,
     risk_score NUMERIC(3, 2),
-    evaluated_at TIMESTAMPTZ DEFAULT now()
+    evaluated_at TIMESTAMPTZ DEFAULT now(),
+    mode TEXT NOT NULL DEFAULT 'enforce',
+    firewall_version INTEGER NOT NULL DEFAULT 0,
+    chain_seq BIGINT, -- Position in the audit hash chain, set by audit_chain_link
+    prev_hash TEXT,
+    row_hash TEXT
 );
 
+-- Every upstream call made for a request, including failed ones that fell back
+CREATE TABLE upstream_attempts (
+    attempt_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id UUID REFERENCES request_logs(request_id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    model TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    latency_ms INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Where each archived request was written. Kept after the request is pruned,
+-- so request_id has no foreign key.
 CREATE TABLE audit_archives (
     archive_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    request_id UUID REFERENCES request_logs(request_id) ON DELETE CASCADE,
+    request_id UUID NOT NULL,
     s3_path TEXT NOT NULL,
     archived_at TIMESTAMPTZ DEFAULT now(),
-    archive_hash TEXT
+    archive_hash TEXT,
+    received_at TIMESTAMPTZ -- When the request was received, for restoring time ranges
+);
+
+-- Hash chain over request_logs, response_logs and firewall_events. Each row
+-- stores the previous row's hash and the hash of its own content chained onto
+-- it, so editing or deleting a row breaks every link after it.
+CREATE TABLE audit_chain_head (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL
 );
+INSERT INTO audit_chain_head (seq, hash) VALUES (0, '');
+
+-- Links of rows that were archived, so pruning them doesn't break the chain
+CREATE TABLE audit_archived_links (
+    chain_seq BIGINT PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    row_hash TEXT NOT NULL,
+    s3_path TEXT NOT NULL
+);
+
+-- A row's content as hashed: every column except the chain's own and the
+-- archive bookkeeping, rendered in UTC so the session time zone doesn't matter
+CREATE FUNCTION audit_content(r anyelement) RETURNS TEXT AS $$
+    SELECT (to_jsonb(r) - 'chain_seq' - 'prev_hash' - 'row_hash' - 'archived' - 'restored_at')::text
+$$ LANGUAGE sql STABLE SET timezone TO 'UTC';
+
+CREATE FUNCTION audit_link_hash(table_name TEXT, seq BIGINT, prev_hash TEXT, content TEXT) RETURNS TEXT AS $$
+    SELECT encode(digest(prev_hash || '|' || table_name || '|' || seq || '|' || content, 'sha256'), 'hex')
+$$ LANGUAGE sql IMMUTABLE;
+
+-- Rows are linked in insert order. The head row stays locked until the
+-- inserting transaction commits, which serializes audit writes. Rows restored
+-- from an archive keep their original link, which must match the one recorded
+-- when they were archived.
+CREATE FUNCTION audit_chain_link() RETURNS trigger AS $$
+DECLARE
+    head audit_chain_head%ROWTYPE;
+BEGIN
+    IF NEW.chain_seq IS NOT NULL THEN
+        PERFORM 1 FROM audit_archived_links
+        WHERE chain_seq = NEW.chain_seq
+        AND table_name = TG_TABLE_NAME
+        AND prev_hash = NEW.prev_hash
+        AND row_hash = NEW.row_hash
+        AND row_hash = audit_link_hash(TG_TABLE_NAME, NEW.chain_seq, NEW.prev_hash, audit_content(NEW));
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'restored % row % does not match its archived link', TG_TABLE_NAME, NEW.chain_seq;
+        END IF;
+        RETURN NEW;
+    END IF;
+
+    SELECT * INTO head FROM audit_chain_head FOR UPDATE;
+    NEW.chain_seq := head.seq + 1;
+    NEW.prev_hash := head.hash;
+    NEW.row_hash := audit_link_hash(TG_TABLE_NAME, NEW.chain_seq, NEW.prev_hash, audit_content(NEW));
+    UPDATE audit_chain_head SET seq = NEW.chain_seq, hash = NEW.row_hash;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER request_logs_chain BEFORE INSERT ON request_logs
+FOR EACH ROW EXECUTE FUNCTION audit_chain_link();
+CREATE TRIGGER response_logs_chain BEFORE INSERT ON response_logs
+FOR EACH ROW EXECUTE FUNCTION audit_chain_link();
+CREATE TRIGGER firewall_events_chain BEFORE INSERT ON firewall_events
+FOR EACH ROW EXECUTE FUNCTION audit_chain_link();
+
+-- Every link in the chain with its hash recomputed from the row's current
+-- content. Archived links appear alongside their rows until those are pruned.
+CREATE VIEW audit_chain_links AS
+SELECT chain_seq, table_name, prev_hash, row_hash, row_hash AS computed_hash, NULL::uuid AS request_id
+FROM audit_archived_links
+UNION ALL
+SELECT r.chain_seq, 'request_logs', COALESCE(r.prev_hash, ''), COALESCE(r.row_hash, ''),
+  COALESCE(audit_link_hash('request_logs', r.chain_seq, r.prev_hash, audit_content(r)), ''), r.request_id
+FROM request_logs r
+UNION ALL
+SELECT r.chain_seq, 'response_logs', COALESCE(r.prev_hash, ''), COALESCE(r.row_hash, ''),
+  COALESCE(audit_link_hash('response_logs', r.chain_seq, r.prev_hash, audit_content(r)), ''), r.request_id
+FROM response_logs r
+UNION ALL
+SELECT r.chain_seq, 'firewall_events', COALESCE(r.prev_hash, ''), COALESCE(r.row_hash, ''),
+  COALESCE(audit_link_hash('firewall_events', r.chain_seq, r.prev_hash, audit_content(r)), ''), r.request_id
+FROM firewall_events r;
 
 -- Indexes
 CREATE INDEX idx_request_user ON request_logs(user_id);
 CREATE INDEX idx_request_time ON request_logs(received_at);
 CREATE INDEX idx_firewall_request ON firewall_events(request_id);
 CREATE INDEX idx_response_request ON response_logs(request_id);
+CREATE INDEX idx_attempt_request ON upstream_attempts(request_id);
+CREATE INDEX idx_archive_request ON audit_archives(request_id);
+CREATE INDEX idx_archive_received ON audit_archives(received_at);
+CREATE INDEX idx_request_unarchived ON request_logs(received_at) WHERE archived = FALSE;
+CREATE UNIQUE INDEX idx_request_chain ON request_logs(chain_seq);
+CREATE UNIQUE INDEX idx_response_chain ON response_logs(chain_seq);
+CREATE UNIQUE INDEX idx_firewall_chain ON firewall_events(chain_seq);
@@ -0,0 +1,19 @@
+-- name: GetCachedResponse :one
+SELECT * FROM response_cache
+WHERE cache_key = $1 AND expires_at > now();
+
+-- name: PutCachedResponse :exec
+INSERT INTO response_cache (
+  cache_key, model, content_type, body, expires_at
+)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (cache_key) DO UPDATE
+SET model = EXCLUDED.model,
+    content_type = EXCLUDED.content_type,
+    body = EXCLUDED.body,
+    created_at = now(),
+    expires_at = EXCLUDED.expires_at;
+
+-- name: DeleteExpiredCachedResponses :exec
+DELETE FROM response_cache
+WHERE expires_at <= now();
@@ -0,0 +1,14 @@
+-- cache_schema.sql
+
+-- Responses shared between covalence instances, keyed by a hash of the request body
+CREATE TABLE response_cache (
+    cache_key TEXT PRIMARY KEY,
+    model TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Indexes
+CREATE INDEX idx_response_cache_expires ON response_cache(expires_at);
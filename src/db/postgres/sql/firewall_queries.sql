@@ -0,0 +1,82 @@
+-- name: CreateFirewallPolicy :one
+-- Revives a deleted policy with the same name; returns no row if one is live
+INSERT INTO firewall_policies (
+  name, api_keys, users, models
+)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (name) DO UPDATE
+SET api_keys = EXCLUDED.api_keys, users = EXCLUDED.users, models = EXCLUDED.models,
+  deleted = FALSE, version = firewall_policies.version + 1, updated_at = now()
+WHERE firewall_policies.deleted = TRUE
+RETURNING *;
+
+-- name: UpdateFirewallPolicy :one
+UPDATE firewall_policies
+SET api_keys = $2, users = $3, models = $4, version = version + 1, updated_at = now()
+WHERE name = $1 AND deleted = FALSE
+RETURNING *;
+
+-- name: DeleteFirewallPolicy :one
+UPDATE firewall_policies
+SET deleted = TRUE, version = version + 1, updated_at = now()
+WHERE name = $1 AND deleted = FALSE
+RETURNING *;
+
+-- name: ListFirewallPolicies :many
+SELECT * FROM firewall_policies
+WHERE deleted = FALSE
+ORDER BY name;
+
+-- name: InsertFirewallPolicyVersion :exec
+INSERT INTO firewall_policy_versions (
+  name, version, api_keys, users, models, deleted, changed_by
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: ListFirewallPolicyVersions :many
+SELECT * FROM firewall_policy_versions
+WHERE name = $1
+ORDER BY version;
+
+-- name: CreateFirewallConfig :one
+INSERT INTO firewall_configs (
+  policy_name, enabled, type, mode, model, blocking_threshold
+)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: UpdateFirewallConfig :one
+UPDATE firewall_configs
+SET policy_name = $2, enabled = $3, type = $4, mode = $5, model = $6, blocking_threshold = $7, version = version + 1, updated_at = now()
+WHERE firewall_id = $1 AND deleted = FALSE
+RETURNING *;
+
+-- name: DeleteFirewallConfig :one
+UPDATE firewall_configs
+SET deleted = TRUE, version = version + 1, updated_at = now()
+WHERE firewall_id = $1 AND deleted = FALSE
+RETURNING *;
+
+-- name: GetFirewallConfig :one
+SELECT * FROM firewall_configs
+WHERE firewall_id = $1 AND deleted = FALSE;
+
+-- name: ListFirewallConfigs :many
+SELECT * FROM firewall_configs
+WHERE deleted = FALSE
+ORDER BY policy_name, firewall_id;
+
+-- name: CountPolicyFirewalls :one
+SELECT COUNT(*) FROM firewall_configs
+WHERE policy_name = $1 AND deleted = FALSE;
+
+-- name: InsertFirewallConfigVersion :exec
+INSERT INTO firewall_config_versions (
+  firewall_id, version, policy_name, enabled, type, mode, model, blocking_threshold, deleted, changed_by
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);
+
+-- name: ListFirewallConfigVersions :many
+SELECT * FROM firewall_config_versions
+WHERE firewall_id = $1
+ORDER BY version;
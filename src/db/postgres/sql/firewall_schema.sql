@@ -0,0 +1,73 @@
+-- firewall_schema.sql
+
+CREATE TABLE firewall_policies (
+    name TEXT PRIMARY KEY,
+    api_keys UUID[] NOT NULL DEFAULT '{}',
+    users UUID[] NOT NULL DEFAULT '{}',
+    models TEXT[] NOT NULL DEFAULT '{}',
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE firewall_policy_versions (
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    api_keys UUID[] NOT NULL,
+    users UUID[] NOT NULL,
+    models TEXT[] NOT NULL,
+    deleted BOOLEAN NOT NULL,
+    changed_by TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (name, version)
+);
+
+CREATE TABLE firewall_configs (
+    firewall_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    policy_name TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    type TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    model TEXT NOT NULL,
+    blocking_threshold REAL NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One row per change, so firewall_events (firewall_id, firewall_version)
+-- can be joined to the exact config that produced a verdict
+CREATE TABLE firewall_config_versions (
+    firewall_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    policy_name TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    type TEXT NOT NULL,
+    mode TEXT NOT NULL,
+    model TEXT NOT NULL,
+    blocking_threshold REAL NOT NULL,
+    deleted BOOLEAN NOT NULL,
+    changed_by TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (firewall_id, version)
+);
+
+-- Tell every covalence instance that the stored firewall config changed so it
+-- can reload it
+CREATE FUNCTION notify_firewall_config() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('firewall_config', TG_TABLE_NAME);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER firewall_policies_notify
+AFTER INSERT OR UPDATE OR DELETE ON firewall_policies
+FOR EACH STATEMENT EXECUTE FUNCTION notify_firewall_config();
+
+CREATE TRIGGER firewall_configs_notify
+AFTER INSERT OR UPDATE OR DELETE ON firewall_configs
+FOR EACH STATEMENT EXECUTE FUNCTION notify_firewall_config();
+
+-- Indexes
+CREATE INDEX idx_firewall_config_policy ON firewall_configs(policy_name);
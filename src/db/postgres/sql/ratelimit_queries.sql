@@ -0,0 +1,13 @@
+-- name: AddRateLimitUsage :one
+INSERT INTO rate_limit_counters (
+  bucket, window_start, requests, tokens
+)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (bucket, window_start) DO UPDATE
+SET requests = rate_limit_counters.requests + EXCLUDED.requests,
+    tokens = rate_limit_counters.tokens + EXCLUDED.tokens
+RETURNING requests, tokens;
+
+-- name: DeleteRateLimitCountersBefore :exec
+DELETE FROM rate_limit_counters
+WHERE window_start < $1;
@@ -0,0 +1,10 @@
+-- ratelimit_schema.sql
+
+-- Usage per rate limit bucket and minute, shared by every covalence instance
+CREATE TABLE rate_limit_counters (
+    bucket TEXT NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    tokens BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, window_start)
+);
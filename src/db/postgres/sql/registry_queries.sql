@@ -0,0 +1,36 @@
+-- name: InsertRegisteredModel :one
+INSERT INTO registered_models (
+  name, model, api_url, provider, status, targets, fallbacks, created_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetRegisteredModel :one
+SELECT * FROM registered_models
+WHERE name = $1;
+
+-- name: ListRegisteredModels :many
+SELECT * FROM registered_models
+ORDER BY name;
+
+-- name: UpdateRegisteredModel :one
+UPDATE registered_models
+SET model = $2, api_url = $3, provider = $4, status = $5, targets = $6, fallbacks = $7, updated_at = now()
+WHERE name = $1
+RETURNING *;
+
+-- name: DeleteRegisteredModel :one
+DELETE FROM registered_models
+WHERE name = $1
+RETURNING *;
+
+-- name: InsertRegisteredModelChange :exec
+INSERT INTO registered_model_changes (
+  name, action, changed_by, before, after
+)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListRegisteredModelChanges :many
+SELECT * FROM registered_model_changes
+WHERE name = $1
+ORDER BY changed_at;
@@ -0,0 +1,43 @@
+-- registry_schema.sql
+
+CREATE TABLE registered_models (
+    name TEXT PRIMARY KEY,
+    model TEXT NOT NULL,
+    api_url TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active',
+    targets JSONB NOT NULL DEFAULT '[]',
+    fallbacks JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Tell every covalence instance which alias changed so it can refresh its cache
+CREATE FUNCTION notify_registered_models() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('registered_models', OLD.name);
+    ELSE
+        PERFORM pg_notify('registered_models', NEW.name);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER registered_models_notify
+AFTER INSERT OR UPDATE OR DELETE ON registered_models
+FOR EACH ROW EXECUTE FUNCTION notify_registered_models();
+
+-- Who changed which alias, with the alias before and after the change
+CREATE TABLE registered_model_changes (
+    change_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    action TEXT NOT NULL,
+    changed_by TEXT NOT NULL,
+    before JSONB,
+    after JSONB,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Indexes
+CREATE INDEX idx_registered_model_changes_name ON registered_model_changes(name);
@@ -0,0 +1,19 @@
+-- name: AddMonthlyUsage :exec
+INSERT INTO usage_monthly (
+  scope, subject, month_start, requests, prompt_tokens, completion_tokens, cost_usd
+)
+VALUES ($1, $2, $3, 1, $4, $5, $6)
+ON CONFLICT (scope, subject, month_start) DO UPDATE
+SET requests = usage_monthly.requests + 1,
+    prompt_tokens = usage_monthly.prompt_tokens + EXCLUDED.prompt_tokens,
+    completion_tokens = usage_monthly.completion_tokens + EXCLUDED.completion_tokens,
+    cost_usd = usage_monthly.cost_usd + EXCLUDED.cost_usd;
+
+-- name: GetMonthlyUsage :one
+SELECT * FROM usage_monthly
+WHERE scope = $1 AND subject = $2 AND month_start = $3;
+
+-- name: ListMonthlyUsage :many
+SELECT * FROM usage_monthly
+WHERE month_start = $1
+ORDER BY cost_usd DESC, subject;
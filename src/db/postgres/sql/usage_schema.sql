@@ -0,0 +1,13 @@
+-- usage_schema.sql
+
+-- Tokens and spend per user or API key and calendar month (UTC), for budgets
+CREATE TABLE usage_monthly (
+    scope TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    month_start TIMESTAMPTZ NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, subject, month_start)
+);
@@ -12,8 +12,103 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const deleteArchivedRequestsBefore = `-- name: DeleteArchivedRequestsBefore :execrows
+DELETE FROM request_logs
+WHERE archived = TRUE
+AND received_at < $1
+AND (restored_at IS NULL OR restored_at < $1)
+`
+
+// Restored requests are kept until they were restored before the cutoff too
+func (q *Queries) DeleteArchivedRequestsBefore(ctx context.Context, receivedAt pgtype.Timestamptz) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteArchivedRequestsBefore, receivedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getAuditArchiveForRequest = `-- name: GetAuditArchiveForRequest :one
+SELECT archive_id, request_id, s3_path, archived_at, archive_hash, received_at FROM audit_archives
+WHERE request_id = $1
+ORDER BY archived_at DESC
+LIMIT 1
+`
+
+func (q *Queries) GetAuditArchiveForRequest(ctx context.Context, requestID pgtype.UUID) (AuditArchive, error) {
+	row := q.db.QueryRow(ctx, getAuditArchiveForRequest, requestID)
+	var i AuditArchive
+	err := row.Scan(
+		&i.ArchiveID,
+		&i.RequestID,
+		&i.S3Path,
+		&i.ArchivedAt,
+		&i.ArchiveHash,
+		&i.ReceivedAt,
+	)
+	return i, err
+}
+
+const getAuditChainHead = `-- name: GetAuditChainHead :one
+SELECT id, seq, hash FROM audit_chain_head
+`
+
+func (q *Queries) GetAuditChainHead(ctx context.Context) (AuditChainHead, error) {
+	row := q.db.QueryRow(ctx, getAuditChainHead)
+	var i AuditChainHead
+	err := row.Scan(
+		&i.ID,
+		&i.Seq,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const getFirewallEventCounts = `-- name: GetFirewallEventCounts :many
+SELECT firewall_id, firewall_type, mode,
+  COUNT(*) AS total,
+  COUNT(*) FILTER (WHERE blocked) AS blocked
+FROM firewall_events
+GROUP BY firewall_id, firewall_type, mode
+ORDER BY firewall_id, mode
+`
+
+type GetFirewallEventCountsRow struct {
+	FirewallID   string
+	FirewallType string
+	Mode         string
+	Total        int64
+	Blocked      int64
+}
+
+func (q *Queries) GetFirewallEventCounts(ctx context.Context) ([]GetFirewallEventCountsRow, error) {
+	rows, err := q.db.Query(ctx, getFirewallEventCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFirewallEventCountsRow
+	for rows.Next() {
+		var i GetFirewallEventCountsRow
+		if err := rows.Scan(
+			&i.FirewallID,
+			&i.FirewallType,
+			&i.Mode,
+			&i.Total,
+			&i.Blocked,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRequestFullTrace = `-- name: GetRequestFullTrace :many
-SELECT rl.request_id, rl.user_id, rl.api_key_id, rl.model, rl.target_url, rl.inputs, rl.parameters, rl.received_at, rl.client_ip, rl.archived, res.response, res.latency_ms, pe.firewall_event_id, pe.request_id, pe.firewall_id, pe.firewall_type, pe.blocked, pe.blocked_reason, pe.risk_score, pe.evaluated_at
+SELECT rl.request_id, rl.user_id, rl.api_key_id, rl.model, rl.target_url, rl.inputs, rl.parameters, rl.received_at, rl.client_ip, rl.archived, rl.alias, rl.chain_seq, rl.prev_hash, rl.row_hash, rl.restored_at, res.response, res.latency_ms, res.prompt_tokens, res.completion_tokens, res.cost_usd, res.cache_hit, res.cache_similarity, pe.firewall_event_id, pe.request_id, pe.firewall_id, pe.firewall_type, pe.blocked, pe.blocked_reason, pe.risk_score, pe.evaluated_at, pe.mode, pe.firewall_version, pe.chain_seq, pe.prev_hash, pe.row_hash
 FROM request_logs rl
 LEFT JOIN response_logs res ON rl.request_id = res.request_id
 LEFT JOIN firewall_events pe ON rl.request_id = pe.request_id
@@ -21,26 +116,41 @@ WHERE rl.request_id = $1
 `
 
 type GetRequestFullTraceRow struct {
-	RequestID       pgtype.UUID
-	UserID          pgtype.UUID
-	ApiKeyID        pgtype.UUID
-	Model           string
-	TargetUrl       string
-	Inputs          [][]byte
-	Parameters      []byte
-	ReceivedAt      pgtype.Timestamptz
-	ClientIp        *netip.Addr
-	Archived        pgtype.Bool
-	Response        []byte
-	LatencyMs       pgtype.Int4
-	FirewallEventID pgtype.UUID
-	RequestID_2     pgtype.UUID
-	FirewallID      pgtype.Text
-	FirewallType    pgtype.Text
-	Blocked         pgtype.Bool
-	BlockedReason   pgtype.Text
-	RiskScore       pgtype.Numeric
-	EvaluatedAt     pgtype.Timestamptz
+	RequestID        pgtype.UUID
+	UserID           pgtype.UUID
+	ApiKeyID         pgtype.UUID
+	Model            string
+	TargetUrl        string
+	Inputs           [][]byte
+	Parameters       []byte
+	ReceivedAt       pgtype.Timestamptz
+	ClientIp         *netip.Addr
+	Archived         pgtype.Bool
+	Alias            string
+	ChainSeq         pgtype.Int8
+	PrevHash         pgtype.Text
+	RowHash          pgtype.Text
+	RestoredAt       pgtype.Timestamptz
+	Response         []byte
+	LatencyMs        pgtype.Int4
+	PromptTokens     pgtype.Int4
+	CompletionTokens pgtype.Int4
+	CostUsd          pgtype.Float8
+	CacheHit         pgtype.Bool
+	CacheSimilarity  pgtype.Float8
+	FirewallEventID  pgtype.UUID
+	RequestID_2      pgtype.UUID
+	FirewallID       pgtype.Text
+	FirewallType     pgtype.Text
+	Blocked          pgtype.Bool
+	BlockedReason    pgtype.Text
+	RiskScore        pgtype.Numeric
+	EvaluatedAt      pgtype.Timestamptz
+	Mode             pgtype.Text
+	FirewallVersion  pgtype.Int4
+	ChainSeq_2       pgtype.Int8
+	PrevHash_2       pgtype.Text
+	RowHash_2        pgtype.Text
 }
 
 func (q *Queries) GetRequestFullTrace(ctx context.Context, requestID pgtype.UUID) ([]GetRequestFullTraceRow, error) {
@@ -63,8 +173,18 @@ func (q *Queries) GetRequestFullTrace(ctx context.Context, requestID pgtype.UUID
 			&i.ReceivedAt,
 			&i.ClientIp,
 			&i.Archived,
+			&i.Alias,
+			&i.ChainSeq,
+			&i.PrevHash,
+			&i.RowHash,
+			&i.RestoredAt,
 			&i.Response,
 			&i.LatencyMs,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CacheSimilarity,
 			&i.FirewallEventID,
 			&i.RequestID_2,
 			&i.FirewallID,
@@ -73,6 +193,11 @@ func (q *Queries) GetRequestFullTrace(ctx context.Context, requestID pgtype.UUID
 			&i.BlockedReason,
 			&i.RiskScore,
 			&i.EvaluatedAt,
+			&i.Mode,
+			&i.FirewallVersion,
+			&i.ChainSeq_2,
+			&i.PrevHash_2,
+			&i.RowHash_2,
 		); err != nil {
 			return nil, err
 		}
@@ -85,13 +210,17 @@ func (q *Queries) GetRequestFullTrace(ctx context.Context, requestID pgtype.UUID
 }
 
 const getUnarchivedRequests = `-- name: GetUnarchivedRequests :many
-SELECT request_id, user_id, api_key_id, model, target_url, inputs, parameters, received_at, client_ip, archived FROM request_logs
+SELECT request_id, user_id, api_key_id, model, target_url, inputs, parameters, received_at, client_ip, archived, alias, chain_seq, prev_hash, row_hash, restored_at FROM request_logs
 WHERE archived = FALSE
 AND received_at < now() - interval '10 minutes'
+ORDER BY received_at
+LIMIT $1
+FOR UPDATE SKIP LOCKED
 `
 
-func (q *Queries) GetUnarchivedRequests(ctx context.Context) ([]RequestLog, error) {
-	rows, err := q.db.Query(ctx, getUnarchivedRequests)
+// Locks the requests it returns, so instances don't archive the same ones
+func (q *Queries) GetUnarchivedRequests(ctx context.Context, limit int32) ([]RequestLog, error) {
+	rows, err := q.db.Query(ctx, getUnarchivedRequests, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +239,11 @@ func (q *Queries) GetUnarchivedRequests(ctx context.Context) ([]RequestLog, erro
 			&i.ReceivedAt,
 			&i.ClientIp,
 			&i.Archived,
+			&i.Alias,
+			&i.ChainSeq,
+			&i.PrevHash,
+			&i.RowHash,
+			&i.RestoredAt,
 		); err != nil {
 			return nil, err
 		}
@@ -121,22 +255,46 @@ func (q *Queries) GetUnarchivedRequests(ctx context.Context) ([]RequestLog, erro
 	return items, nil
 }
 
+const insertArchivedLinksForRequests = `-- name: InsertArchivedLinksForRequests :exec
+INSERT INTO audit_archived_links (chain_seq, table_name, prev_hash, row_hash, s3_path)
+SELECT chain_seq, table_name, prev_hash, row_hash, $2
+FROM audit_chain_links
+WHERE request_id = ANY($1::uuid[])
+ON CONFLICT (chain_seq) DO NOTHING
+`
+
+type InsertArchivedLinksForRequestsParams struct {
+	Column1 []pgtype.UUID
+	S3Path  string
+}
+
+func (q *Queries) InsertArchivedLinksForRequests(ctx context.Context, arg InsertArchivedLinksForRequestsParams) error {
+	_, err := q.db.Exec(ctx, insertArchivedLinksForRequests, arg.Column1, arg.S3Path)
+	return err
+}
+
 const insertAuditArchive = `-- name: InsertAuditArchive :one
 INSERT INTO audit_archives (
-  request_id, s3_path, archive_hash
+  request_id, s3_path, archive_hash, received_at
 )
-VALUES ($1, $2, $3)
-RETURNING archive_id, request_id, s3_path, archived_at, archive_hash
+VALUES ($1, $2, $3, $4)
+RETURNING archive_id, request_id, s3_path, archived_at, archive_hash, received_at
 `
 
 type InsertAuditArchiveParams struct {
 	RequestID   pgtype.UUID
 	S3Path      string
 	ArchiveHash pgtype.Text
+	ReceivedAt  pgtype.Timestamptz
 }
 
 func (q *Queries) InsertAuditArchive(ctx context.Context, arg InsertAuditArchiveParams) (AuditArchive, error) {
-	row := q.db.QueryRow(ctx, insertAuditArchive, arg.RequestID, arg.S3Path, arg.ArchiveHash)
+	row := q.db.QueryRow(ctx, insertAuditArchive,
+		arg.RequestID,
+		arg.S3Path,
+		arg.ArchiveHash,
+		arg.ReceivedAt,
+	)
 	var i AuditArchive
 	err := row.Scan(
 		&i.ArchiveID,
@@ -144,59 +302,26 @@ func (q *Queries) InsertAuditArchive(ctx context.Context, arg InsertAuditArchive
 		&i.S3Path,
 		&i.ArchivedAt,
 		&i.ArchiveHash,
+		&i.ReceivedAt,
 	)
 	return i, err
 }
 
-const insertFirewallEvent = `-- name: InsertFirewallEvent :one
-INSERT INTO firewall_events (
-  request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score
-)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING firewall_event_id, request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score, evaluated_at
-`
-
-type InsertFirewallEventParams struct {
-	RequestID     pgtype.UUID
-	FirewallID    string
-	FirewallType  string
-	Blocked       pgtype.Bool
-	BlockedReason pgtype.Text
-	RiskScore     pgtype.Numeric
-}
-
-func (q *Queries) InsertFirewallEvent(ctx context.Context, arg InsertFirewallEventParams) (FirewallEvent, error) {
-	row := q.db.QueryRow(ctx, insertFirewallEvent,
-		arg.RequestID,
-		arg.FirewallID,
-		arg.FirewallType,
-		arg.Blocked,
-		arg.BlockedReason,
-		arg.RiskScore,
-	)
-	var i FirewallEvent
-	err := row.Scan(
-		&i.FirewallEventID,
-		&i.RequestID,
-		&i.FirewallID,
-		&i.FirewallType,
-		&i.Blocked,
-		&i.BlockedReason,
-		&i.RiskScore,
-		&i.EvaluatedAt,
-	)
-	return i, err
+type InsertFirewallEventsParams struct {
+	FirewallEventID pgtype.UUID
+	RequestID       pgtype.UUID
+	FirewallID      string
+	FirewallType    string
+	Blocked         pgtype.Bool
+	BlockedReason   pgtype.Text
+	RiskScore       pgtype.Numeric
+	Mode            string
+	FirewallVersion int32
+	EvaluatedAt     pgtype.Timestamptz
 }
 
-const insertRequestLog = `-- name: InsertRequestLog :one
-INSERT INTO request_logs (
-  user_id, api_key_id, model, target_url, inputs, parameters, client_ip
-)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING request_id, user_id, api_key_id, model, target_url, inputs, parameters, received_at, client_ip, archived
-`
-
-type InsertRequestLogParams struct {
+type InsertRequestLogsParams struct {
+	RequestID  pgtype.UUID
 	UserID     pgtype.UUID
 	ApiKeyID   pgtype.UUID
 	Model      string
@@ -204,59 +329,348 @@ type InsertRequestLogParams struct {
 	Inputs     [][]byte
 	Parameters []byte
 	ClientIp   *netip.Addr
+	Alias      string
+	ReceivedAt pgtype.Timestamptz
 }
 
-func (q *Queries) InsertRequestLog(ctx context.Context, arg InsertRequestLogParams) (RequestLog, error) {
-	row := q.db.QueryRow(ctx, insertRequestLog,
-		arg.UserID,
-		arg.ApiKeyID,
-		arg.Model,
-		arg.TargetUrl,
-		arg.Inputs,
-		arg.Parameters,
-		arg.ClientIp,
-	)
-	var i RequestLog
-	err := row.Scan(
-		&i.RequestID,
-		&i.UserID,
-		&i.ApiKeyID,
-		&i.Model,
-		&i.TargetUrl,
-		&i.Inputs,
-		&i.Parameters,
-		&i.ReceivedAt,
-		&i.ClientIp,
-		&i.Archived,
-	)
-	return i, err
+type InsertResponseLogsParams struct {
+	ResponseID       pgtype.UUID
+	RequestID        pgtype.UUID
+	Response         []byte
+	LatencyMs        pgtype.Int4
+	PromptTokens     int32
+	CompletionTokens int32
+	CostUsd          float64
+	CacheHit         bool
+	CacheSimilarity  pgtype.Float8
+	CreatedAt        pgtype.Timestamptz
 }
 
-const insertResponseLog = `-- name: InsertResponseLog :one
-INSERT INTO response_logs (
-  request_id, response, latency_ms
-)
-VALUES ($1, $2, $3)
-RETURNING response_id, request_id, response, created_at, latency_ms
+type InsertUpstreamAttemptsParams struct {
+	AttemptID  pgtype.UUID
+	RequestID  pgtype.UUID
+	Attempt    int32
+	Model      string
+	Provider   string
+	TargetUrl  string
+	StatusCode pgtype.Int4
+	Error      pgtype.Text
+	LatencyMs  pgtype.Int4
+	CreatedAt  pgtype.Timestamptz
+}
+
+const listAuditArchivesReceivedBetween = `-- name: ListAuditArchivesReceivedBetween :many
+SELECT s3_path, archive_hash
+FROM audit_archives
+WHERE received_at >= $1 AND received_at < $2
+GROUP BY s3_path, archive_hash
+ORDER BY MIN(received_at)
 `
 
-type InsertResponseLogParams struct {
-	RequestID pgtype.UUID
-	Response  []byte
-	LatencyMs pgtype.Int4
+type ListAuditArchivesReceivedBetweenParams struct {
+	ReceivedAt   pgtype.Timestamptz
+	ReceivedAt_2 pgtype.Timestamptz
 }
 
-func (q *Queries) InsertResponseLog(ctx context.Context, arg InsertResponseLogParams) (ResponseLog, error) {
-	row := q.db.QueryRow(ctx, insertResponseLog, arg.RequestID, arg.Response, arg.LatencyMs)
-	var i ResponseLog
-	err := row.Scan(
-		&i.ResponseID,
-		&i.RequestID,
-		&i.Response,
-		&i.CreatedAt,
-		&i.LatencyMs,
-	)
-	return i, err
+type ListAuditArchivesReceivedBetweenRow struct {
+	S3Path      string
+	ArchiveHash pgtype.Text
+}
+
+// Archive objects holding requests received in [$1, $2)
+func (q *Queries) ListAuditArchivesReceivedBetween(ctx context.Context, arg ListAuditArchivesReceivedBetweenParams) ([]ListAuditArchivesReceivedBetweenRow, error) {
+	rows, err := q.db.Query(ctx, listAuditArchivesReceivedBetween, arg.ReceivedAt, arg.ReceivedAt_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAuditArchivesReceivedBetweenRow
+	for rows.Next() {
+		var i ListAuditArchivesReceivedBetweenRow
+		if err := rows.Scan(
+			&i.S3Path,
+			&i.ArchiveHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditChainLinks = `-- name: ListAuditChainLinks :many
+SELECT chain_seq, table_name, prev_hash, row_hash, computed_hash
+FROM audit_chain_links
+WHERE chain_seq > $1 AND chain_seq <= $2
+ORDER BY chain_seq
+`
+
+type ListAuditChainLinksParams struct {
+	After   int64
+	Through int64
+}
+
+type ListAuditChainLinksRow struct {
+	ChainSeq     int64
+	TableName    string
+	PrevHash     string
+	RowHash      string
+	ComputedHash string
+}
+
+// Links with after < chain_seq <= through. A link that was archived but not
+// yet pruned is listed twice.
+func (q *Queries) ListAuditChainLinks(ctx context.Context, arg ListAuditChainLinksParams) ([]ListAuditChainLinksRow, error) {
+	rows, err := q.db.Query(ctx, listAuditChainLinks, arg.After, arg.Through)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAuditChainLinksRow
+	for rows.Next() {
+		var i ListAuditChainLinksRow
+		if err := rows.Scan(
+			&i.ChainSeq,
+			&i.TableName,
+			&i.PrevHash,
+			&i.RowHash,
+			&i.ComputedHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBrokenLinksForRequests = `-- name: ListBrokenLinksForRequests :many
+SELECT COALESCE(l.chain_seq, 0)::bigint AS chain_seq, l.table_name
+FROM audit_chain_links l
+LEFT JOIN LATERAL (
+  SELECT p.row_hash FROM audit_chain_links p
+  WHERE p.chain_seq = l.chain_seq - 1
+  LIMIT 1
+) prev ON TRUE
+WHERE l.request_id = ANY($1::uuid[])
+AND (l.row_hash = ''
+  OR l.computed_hash <> l.row_hash
+  OR l.prev_hash IS DISTINCT FROM COALESCE(prev.row_hash, CASE WHEN l.chain_seq = 1 THEN '' END))
+ORDER BY l.chain_seq
+`
+
+type ListBrokenLinksForRequestsRow struct {
+	ChainSeq  int64
+	TableName string
+}
+
+// Links recorded for the requests whose content no longer matches their hash
+// or whose previous hash doesn't match the link before them
+func (q *Queries) ListBrokenLinksForRequests(ctx context.Context, dollar_1 []pgtype.UUID) ([]ListBrokenLinksForRequestsRow, error) {
+	rows, err := q.db.Query(ctx, listBrokenLinksForRequests, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListBrokenLinksForRequestsRow
+	for rows.Next() {
+		var i ListBrokenLinksForRequestsRow
+		if err := rows.Scan(
+			&i.ChainSeq,
+			&i.TableName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExistingRequests = `-- name: ListExistingRequests :many
+SELECT request_id FROM request_logs
+WHERE request_id = ANY($1::uuid[])
+`
+
+func (q *Queries) ListExistingRequests(ctx context.Context, dollar_1 []pgtype.UUID) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listExistingRequests, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []pgtype.UUID
+	for rows.Next() {
+		var request_id pgtype.UUID
+		if err := rows.Scan(&request_id); err != nil {
+			return nil, err
+		}
+		items = append(items, request_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFirewallEventsForRequests = `-- name: ListFirewallEventsForRequests :many
+SELECT firewall_event_id, request_id, firewall_id, firewall_type, blocked, blocked_reason, risk_score, evaluated_at, mode, firewall_version, chain_seq, prev_hash, row_hash FROM firewall_events
+WHERE request_id = ANY($1::uuid[])
+ORDER BY evaluated_at
+`
+
+func (q *Queries) ListFirewallEventsForRequests(ctx context.Context, dollar_1 []pgtype.UUID) ([]FirewallEvent, error) {
+	rows, err := q.db.Query(ctx, listFirewallEventsForRequests, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FirewallEvent
+	for rows.Next() {
+		var i FirewallEvent
+		if err := rows.Scan(
+			&i.FirewallEventID,
+			&i.RequestID,
+			&i.FirewallID,
+			&i.FirewallType,
+			&i.Blocked,
+			&i.BlockedReason,
+			&i.RiskScore,
+			&i.EvaluatedAt,
+			&i.Mode,
+			&i.FirewallVersion,
+			&i.ChainSeq,
+			&i.PrevHash,
+			&i.RowHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listResponseLogsForRequests = `-- name: ListResponseLogsForRequests :many
+SELECT response_id, request_id, response, created_at, latency_ms, prompt_tokens, completion_tokens, cost_usd, cache_hit, cache_similarity, chain_seq, prev_hash, row_hash FROM response_logs
+WHERE request_id = ANY($1::uuid[])
+ORDER BY created_at
+`
+
+func (q *Queries) ListResponseLogsForRequests(ctx context.Context, dollar_1 []pgtype.UUID) ([]ResponseLog, error) {
+	rows, err := q.db.Query(ctx, listResponseLogsForRequests, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ResponseLog
+	for rows.Next() {
+		var i ResponseLog
+		if err := rows.Scan(
+			&i.ResponseID,
+			&i.RequestID,
+			&i.Response,
+			&i.CreatedAt,
+			&i.LatencyMs,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.CostUsd,
+			&i.CacheHit,
+			&i.CacheSimilarity,
+			&i.ChainSeq,
+			&i.PrevHash,
+			&i.RowHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUpstreamAttempts = `-- name: ListUpstreamAttempts :many
+SELECT attempt_id, request_id, attempt, model, provider, target_url, status_code, error, latency_ms, created_at FROM upstream_attempts
+WHERE request_id = $1
+ORDER BY attempt
+`
+
+func (q *Queries) ListUpstreamAttempts(ctx context.Context, requestID pgtype.UUID) ([]UpstreamAttempt, error) {
+	rows, err := q.db.Query(ctx, listUpstreamAttempts, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpstreamAttempt
+	for rows.Next() {
+		var i UpstreamAttempt
+		if err := rows.Scan(
+			&i.AttemptID,
+			&i.RequestID,
+			&i.Attempt,
+			&i.Model,
+			&i.Provider,
+			&i.TargetUrl,
+			&i.StatusCode,
+			&i.Error,
+			&i.LatencyMs,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUpstreamAttemptsForRequests = `-- name: ListUpstreamAttemptsForRequests :many
+SELECT attempt_id, request_id, attempt, model, provider, target_url, status_code, error, latency_ms, created_at FROM upstream_attempts
+WHERE request_id = ANY($1::uuid[])
+ORDER BY request_id, attempt
+`
+
+func (q *Queries) ListUpstreamAttemptsForRequests(ctx context.Context, dollar_1 []pgtype.UUID) ([]UpstreamAttempt, error) {
+	rows, err := q.db.Query(ctx, listUpstreamAttemptsForRequests, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpstreamAttempt
+	for rows.Next() {
+		var i UpstreamAttempt
+		if err := rows.Scan(
+			&i.AttemptID,
+			&i.RequestID,
+			&i.Attempt,
+			&i.Model,
+			&i.Provider,
+			&i.TargetUrl,
+			&i.StatusCode,
+			&i.Error,
+			&i.LatencyMs,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markRequestArchived = `-- name: MarkRequestArchived :exec
@@ -269,3 +683,66 @@ func (q *Queries) MarkRequestArchived(ctx context.Context, requestID pgtype.UUID
 	_, err := q.db.Exec(ctx, markRequestArchived, requestID)
 	return err
 }
+
+type RestoreFirewallEventsParams struct {
+	FirewallEventID pgtype.UUID
+	RequestID       pgtype.UUID
+	FirewallID      string
+	FirewallType    string
+	Blocked         pgtype.Bool
+	BlockedReason   pgtype.Text
+	RiskScore       pgtype.Numeric
+	EvaluatedAt     pgtype.Timestamptz
+	Mode            string
+	FirewallVersion int32
+	ChainSeq        pgtype.Int8
+	PrevHash        pgtype.Text
+	RowHash         pgtype.Text
+}
+
+type RestoreRequestLogsParams struct {
+	RequestID  pgtype.UUID
+	UserID     pgtype.UUID
+	ApiKeyID   pgtype.UUID
+	Model      string
+	TargetUrl  string
+	Inputs     [][]byte
+	Parameters []byte
+	ReceivedAt pgtype.Timestamptz
+	ClientIp   *netip.Addr
+	Archived   pgtype.Bool
+	Alias      string
+	ChainSeq   pgtype.Int8
+	PrevHash   pgtype.Text
+	RowHash    pgtype.Text
+	RestoredAt pgtype.Timestamptz
+}
+
+type RestoreResponseLogsParams struct {
+	ResponseID       pgtype.UUID
+	RequestID        pgtype.UUID
+	Response         []byte
+	CreatedAt        pgtype.Timestamptz
+	LatencyMs        pgtype.Int4
+	PromptTokens     int32
+	CompletionTokens int32
+	CostUsd          float64
+	CacheHit         bool
+	CacheSimilarity  pgtype.Float8
+	ChainSeq         pgtype.Int8
+	PrevHash         pgtype.Text
+	RowHash          pgtype.Text
+}
+
+type RestoreUpstreamAttemptsParams struct {
+	AttemptID  pgtype.UUID
+	RequestID  pgtype.UUID
+	Attempt    int32
+	Model      string
+	Provider   string
+	TargetUrl  string
+	StatusCode pgtype.Int4
+	Error      pgtype.Text
+	LatencyMs  pgtype.Int4
+	CreatedAt  pgtype.Timestamptz
+}
@@ -16,6 +16,48 @@ type AuditArchive struct {
 	S3Path      string
 	ArchivedAt  pgtype.Timestamptz
 	ArchiveHash pgtype.Text
+	ReceivedAt  pgtype.Timestamptz
+}
+
+type AuditArchivedLink struct {
+	ChainSeq  int64
+	TableName string
+	PrevHash  string
+	RowHash   string
+	S3Path    string
+}
+
+type AuditChainHead struct {
+	ID   bool
+	Seq  int64
+	Hash string
+}
+
+type FirewallConfig struct {
+	FirewallID        pgtype.UUID
+	PolicyName        string
+	Enabled           bool
+	Type              string
+	Mode              string
+	Model             string
+	BlockingThreshold float32
+	Version           int32
+	Deleted           bool
+	UpdatedAt         pgtype.Timestamptz
+}
+
+type FirewallConfigVersion struct {
+	FirewallID        pgtype.UUID
+	Version           int32
+	PolicyName        string
+	Enabled           bool
+	Type              string
+	Mode              string
+	Model             string
+	BlockingThreshold float32
+	Deleted           bool
+	ChangedBy         string
+	ChangedAt         pgtype.Timestamptz
 }
 
 type FirewallEvent struct {
@@ -27,6 +69,61 @@ type FirewallEvent struct {
 	BlockedReason   pgtype.Text
 	RiskScore       pgtype.Numeric
 	EvaluatedAt     pgtype.Timestamptz
+	Mode            string
+	FirewallVersion int32
+	ChainSeq        pgtype.Int8
+	PrevHash        pgtype.Text
+	RowHash         pgtype.Text
+}
+
+type FirewallPolicy struct {
+	Name      string
+	ApiKeys   []pgtype.UUID
+	Users     []pgtype.UUID
+	Models    []string
+	Version   int32
+	Deleted   bool
+	UpdatedAt pgtype.Timestamptz
+}
+
+type FirewallPolicyVersion struct {
+	Name      string
+	Version   int32
+	ApiKeys   []pgtype.UUID
+	Users     []pgtype.UUID
+	Models    []string
+	Deleted   bool
+	ChangedBy string
+	ChangedAt pgtype.Timestamptz
+}
+
+type RateLimitCounter struct {
+	Bucket      string
+	WindowStart pgtype.Timestamptz
+	Requests    int64
+	Tokens      int64
+}
+
+type RegisteredModel struct {
+	Name      string
+	Model     string
+	ApiUrl    string
+	Provider  string
+	Status    string
+	Targets   []byte
+	Fallbacks []byte
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
+}
+
+type RegisteredModelChange struct {
+	ChangeID  pgtype.UUID
+	Name      string
+	Action    string
+	ChangedBy string
+	Before    []byte
+	After     []byte
+	ChangedAt pgtype.Timestamptz
 }
 
 type RequestLog struct {
@@ -40,12 +137,57 @@ type RequestLog struct {
 	ReceivedAt pgtype.Timestamptz
 	ClientIp   *netip.Addr
 	Archived   pgtype.Bool
+	Alias      string
+	ChainSeq   pgtype.Int8
+	PrevHash   pgtype.Text
+	RowHash    pgtype.Text
+	RestoredAt pgtype.Timestamptz
+}
+
+type ResponseCache struct {
+	CacheKey    string
+	Model       string
+	ContentType string
+	Body        []byte
+	CreatedAt   pgtype.Timestamptz
+	ExpiresAt   pgtype.Timestamptz
 }
 
 type ResponseLog struct {
-	ResponseID pgtype.UUID
+	ResponseID       pgtype.UUID
+	RequestID        pgtype.UUID
+	Response         []byte
+	CreatedAt        pgtype.Timestamptz
+	LatencyMs        pgtype.Int4
+	PromptTokens     int32
+	CompletionTokens int32
+	CostUsd          float64
+	CacheHit         bool
+	CacheSimilarity  pgtype.Float8
+	ChainSeq         pgtype.Int8
+	PrevHash         pgtype.Text
+	RowHash          pgtype.Text
+}
+
+type UpstreamAttempt struct {
+	AttemptID  pgtype.UUID
 	RequestID  pgtype.UUID
-	Response   []byte
-	CreatedAt  pgtype.Timestamptz
+	Attempt    int32
+	Model      string
+	Provider   string
+	TargetUrl  string
+	StatusCode pgtype.Int4
+	Error      pgtype.Text
 	LatencyMs  pgtype.Int4
+	CreatedAt  pgtype.Timestamptz
+}
+
+type UsageMonthly struct {
+	Scope            string
+	Subject          string
+	MonthStart       pgtype.Timestamptz
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	CostUsd          float64
 }
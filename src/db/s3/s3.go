@@ -211,9 +211,17 @@ func (c *Client) SetBucketPolicy(bucketName, policy string) error {
 
 // GetPresignedURL generates a presigned URL for an object with specified expiration
 func (c *Client) GetPresignedURL(bucketName, objectName string, expiry time.Duration) (string, error) {
-	// Note: For presigned URLs we need to use the aws-sdk-go-v2/feature/s3/manager package
-	// This is a simplified implementation
+	ctx := context.TODO()
+
+	presigner := s3.NewPresignClient(c.s3Client)
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucketName),
+		Key:    aws.String(objectName),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign object: %w", err)
+	}
+
 	log.Printf("Generated presigned URL for '%s' in bucket '%s'", objectName, bucketName)
-	return fmt.Sprintf("https://%s/%s/%s?signature=xxx&expires=%d",
-		bucketName, objectName, time.Now().Add(expiry).Unix()), nil
+	return req.URL, nil
 }
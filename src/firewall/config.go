@@ -14,8 +14,10 @@ type Firewall struct {
 	Enabled           bool
 	ID                uuid.UUID
 	Type              types.FirewallType
+	Mode              types.FirewallMode
 	Model             internal.Model
 	BlockingThreshold float32
+	Version           int32 // Stored config version, 0 for firewalls from config.yaml
 }
 
 type Config struct {
@@ -27,57 +29,122 @@ type rawFirewall struct {
 	ID                string  `yaml:"id"`
 	Enabled           bool    `yaml:"enabled"`
 	Type              string  `yaml:"type"`
+	Mode              string  `yaml:"mode"`
 	Model             string  `yaml:"model"`
 	BlockingThreshold float32 `yaml:"blocking_threshold"`
 }
 
+type rawPolicy struct {
+	Name      string        `yaml:"name"`
+	Firewalls []rawFirewall `yaml:"firewalls"`
+	APIKeys   []string      `yaml:"api_keys"`
+	Users     []string      `yaml:"users"`
+	Models    []string      `yaml:"models"`
+}
+
 type rawConfig struct {
 	Name      string        `yaml:"name"`
 	Firewalls []rawFirewall `yaml:"firewalls"`
+	Policies  []rawPolicy   `yaml:"policies"`
 }
 
+// LoadConfig reads the default firewall config against the loaded internal models
 func LoadConfig(path string) (Config, error) {
-	data, err := os.ReadFile(path)
+	policies, err := ReadPolicies(path, internal.GetModels())
 	if err != nil {
 		return Config{}, err
 	}
+	return policies.Default, nil
+}
+
+// ReadPolicies reads the default firewall config and any named policies,
+// resolving firewall models from the given list
+func ReadPolicies(path string, models []internal.Model) (Policies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policies{}, err
+	}
 
 	var raw rawConfig
 	err = yaml.Unmarshal(data, &raw)
 	if err != nil {
-		return Config{}, err
+		return Policies{}, err
+	}
+
+	defaultConfig, err := parseConfig(raw.Name, raw.Firewalls, models)
+	if err != nil {
+		return Policies{}, err
 	}
 
-	var cfg Config
-	for _, rf := range raw.Firewalls {
-		ft, err := types.NewFirewallType(rf.Type)
+	policies := NewPolicies(defaultConfig)
+	for _, rp := range raw.Policies {
+		cfg, err := parseConfig(rp.Name, rp.Firewalls, models)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid firewall type: %w", err)
+			return Policies{}, fmt.Errorf("policy %s: %w", rp.Name, err)
 		}
 
-		id, err := uuid.Parse(rf.ID)
+		err = policies.Add(cfg, Binding{
+			APIKeys: rp.APIKeys,
+			Users:   rp.Users,
+			Models:  rp.Models,
+		})
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid firewall ID: %w", err)
+			return Policies{}, err
 		}
+	}
+
+	return policies, nil
+}
 
-		modelID, err := types.NewModelID(rf.Model)
+func parseConfig(name string, rawFirewalls []rawFirewall, models []internal.Model) (Config, error) {
+	cfg := Config{Name: name}
+	for _, rf := range rawFirewalls {
+		firewall, err := parseFirewall(rf, models)
 		if err != nil {
-			return Config{}, fmt.Errorf("invalid model: %w", err)
+			return Config{}, err
 		}
+		cfg.Firewalls = append(cfg.Firewalls, firewall)
+	}
 
-		model, err := internal.GetModel(modelID)
+	return cfg, nil
+}
+
+func parseFirewall(rf rawFirewall, models []internal.Model) (Firewall, error) {
+	ft, err := types.NewFirewallType(rf.Type)
+	if err != nil {
+		return Firewall{}, fmt.Errorf("invalid firewall type: %w", err)
+	}
+
+	// Firewalls enforce unless explicitly put in monitor mode
+	mode := types.Enforce()
+	if rf.Mode != "" {
+		mode, err = types.NewFirewallMode(rf.Mode)
 		if err != nil {
-			return Config{}, fmt.Errorf("failed to get model: %w", err)
+			return Firewall{}, fmt.Errorf("invalid firewall mode: %w", err)
 		}
+	}
 
-		cfg.Firewalls = append(cfg.Firewalls, Firewall{
-			Enabled:           rf.Enabled,
-			ID:                id,
-			Type:              ft,
-			Model:             model,
-			BlockingThreshold: rf.BlockingThreshold,
-		})
+	id, err := uuid.Parse(rf.ID)
+	if err != nil {
+		return Firewall{}, fmt.Errorf("invalid firewall ID: %w", err)
 	}
 
-	return cfg, nil
+	modelID, err := types.NewModelID(rf.Model)
+	if err != nil {
+		return Firewall{}, fmt.Errorf("invalid model: %w", err)
+	}
+
+	model, err := internal.FindModel(models, modelID)
+	if err != nil {
+		return Firewall{}, fmt.Errorf("failed to get model: %w", err)
+	}
+
+	return Firewall{
+		Enabled:           rf.Enabled,
+		ID:                id,
+		Type:              ft,
+		Mode:              mode,
+		Model:             model,
+		BlockingThreshold: rf.BlockingThreshold,
+	}, nil
 }
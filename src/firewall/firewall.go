@@ -1,14 +1,13 @@
 package firewall
 
 import (
-	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"covalence/src/apierror"
 	"covalence/src/audit"
-	"covalence/src/db/postgres"
 	custom "covalence/src/firewall/custom"
 	hallucinationRisk "covalence/src/firewall/hallucination_risk"
 	maliciousIntent "covalence/src/firewall/malicious_intent"
@@ -55,16 +54,58 @@ func (f Firewall) Apply(messages []types.Message) (bool, error) {
 
 func HookFirewalls(c *gin.Context, payload *request.Generate, config *Config) (int, error) {
 	log.Printf("firewall hook called with payload")
-	db := c.MustGet("db").(*postgres.DB)
+
+	// A batch of completion prompts are separate requests, so each is checked
+	if payload.Format == request.FormatCompletions && !payload.StringInput {
+		return HookInputs(c, payload.Messages, config)
+	}
+
+	// Responses API instructions go upstream with the input, so they are
+	// checked too, on their own as firewalls only look at the latest message
+	if payload.Format == request.FormatResponses && payload.Instructions != "" {
+		instructions := types.Message{Role: "system", Content: payload.Instructions}
+		if status, err := runFirewalls(c, []types.Message{instructions}, config); err != nil {
+			return status, err
+		}
+	}
+
+	return runFirewalls(c, payload.Messages, config)
+}
+
+// HookInputs runs the firewalls over each input on its own, for requests such
+// as embeddings whose inputs aren't a conversation
+func HookInputs(c *gin.Context, inputs []types.Message, config *Config) (int, error) {
+	log.Printf("firewall hook called with %d inputs", len(inputs))
+	for _, input := range inputs {
+		if status, err := runFirewalls(c, []types.Message{input}, config); err != nil {
+			return status, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// runFirewalls applies each firewall to the latest message and logs its verdict
+func runFirewalls(c *gin.Context, messages []types.Message, config *Config) (int, error) {
+	auditWriter := c.MustGet("audit").(*audit.Writer)
 	requestID := c.MustGet("requestID").(string)
 
 	// Check latest message
 	for _, firewall := range config.Firewalls {
-		res, err := firewall.Apply(payload.Messages)
+		res, err := firewall.Apply(messages)
 		if err != nil {
+			// A monitor firewall must never affect the request, even when it fails
+			if firewall.Mode.IsMonitor() {
+				log.Printf("monitor firewall %s failed: %v", firewall.Type.String(), err)
+				continue
+			}
 			return http.StatusInternalServerError, err
 		}
 
+		reason := ""
+		if !res {
+			reason = fmt.Sprintf("flagged by %s firewall", firewall.Type.String())
+		}
+
 		// Log the firewall event
 		loggingStartTime := time.Now()
 		utils.BoxLog(fmt.Sprintf("audit loggging: firewall event %s 📝", firewall.Type.String()))
@@ -73,18 +114,26 @@ func HookFirewalls(c *gin.Context, payload *request.Generate, config *Config) (i
 			RequestID:     requestID,
 			FirewallID:    firewall.ID.String(),
 			FirewallType:  firewall.Type.String(),
+			Mode:          firewall.Mode.String(),
+			Version:       firewall.Version,
 			Blocked:       !res,
-			BlockedReason: "",
+			BlockedReason: reason,
 			RiskScore:     0.0,
 		}
 
-		audit.LogFirewallEvent(c, fe, db)
+		if err := auditWriter.LogFirewallEvent(c.Request.Context(), fe); err != nil {
+			log.Printf("failed to log firewall event: %v", err)
+		}
 
 		loggingEndTime := time.Since(loggingStartTime)
 		log.Printf("firewall audit logging took %s", loggingEndTime)
 
 		if !res {
-			return http.StatusForbidden, errors.New("request rejected: blocked by firewall")
+			if firewall.Mode.IsMonitor() {
+				log.Printf("monitor firewall %s would have blocked the request", firewall.Type.String())
+				continue
+			}
+			return http.StatusForbidden, apierror.FirewallBlocked(firewall.ID.String(), firewall.Type.String(), reason)
 		}
 	}
 
@@ -0,0 +1,122 @@
+package firewall
+
+import (
+	"context"
+	"covalence/src/apierror"
+	"covalence/src/audit"
+	"covalence/src/types"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ModerationFirewall is the firewall ID and type moderation verdicts are logged under
+const ModerationFirewall = "moderation"
+
+type rawModerationConfig struct {
+	Moderation struct {
+		FoldVerdicts bool   `yaml:"fold_verdicts"`
+		Mode         string `yaml:"mode"`
+	} `yaml:"moderation"`
+}
+
+// ModerationConfig is whether results from /v1/moderations are folded into the
+// firewall verdicts, and in which mode
+type ModerationConfig struct {
+	FoldVerdicts bool
+	Mode         types.FirewallMode
+}
+
+// ReadModerationConfig reads the moderation section of a config file. The mode
+// defaults to monitor.
+func ReadModerationConfig(path string) (ModerationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ModerationConfig{}, err
+	}
+
+	var raw rawModerationConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return ModerationConfig{}, err
+	}
+
+	config := ModerationConfig{FoldVerdicts: raw.Moderation.FoldVerdicts, Mode: types.Monitor()}
+	if raw.Moderation.Mode != "" {
+		config.Mode, err = types.NewFirewallMode(raw.Moderation.Mode)
+		if err != nil {
+			return ModerationConfig{}, fmt.Errorf("moderation: %w", err)
+		}
+	}
+
+	return config, nil
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		Categories     map[string]bool    `json:"categories"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// FoldModeration records each result of a moderation response as a firewall
+// event in the configured mode, so flagged inputs show in the trace and
+// firewall stats like any other verdict. In enforce mode a flagged result
+// blocks the response.
+func FoldModeration(ctx context.Context, auditWriter *audit.Writer, requestID string, mode types.FirewallMode, body []byte) (int, error) {
+	var response moderationResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		log.Printf("failed to parse moderation response: %v", err)
+		if mode.IsMonitor() {
+			return http.StatusOK, nil
+		}
+		// Without a verdict an enforcing policy can't let the response through
+		return http.StatusBadGateway, apierror.New(http.StatusBadGateway, "invalid moderation response from upstream")
+	}
+
+	var blockedReason string
+	for _, result := range response.Results {
+		var flagged []string
+		for category, isFlagged := range result.Categories {
+			if isFlagged {
+				flagged = append(flagged, category)
+			}
+		}
+		sort.Strings(flagged)
+
+		var riskScore float64
+		for _, score := range result.CategoryScores {
+			riskScore = max(riskScore, score)
+		}
+
+		reason := strings.Join(flagged, ", ")
+		if result.Flagged && blockedReason == "" {
+			blockedReason = reason
+		}
+
+		err := auditWriter.LogFirewallEvent(ctx, audit.FirewallEvent{
+			RequestID:     requestID,
+			FirewallID:    ModerationFirewall,
+			FirewallType:  ModerationFirewall,
+			Mode:          mode.String(),
+			Blocked:       result.Flagged,
+			BlockedReason: reason,
+			RiskScore:     riskScore,
+		})
+		if err != nil {
+			log.Printf("failed to log moderation verdict: %v", err)
+		}
+	}
+
+	if blockedReason != "" && !mode.IsMonitor() {
+		return http.StatusForbidden, apierror.FirewallBlocked(ModerationFirewall, ModerationFirewall, blockedReason)
+	}
+
+	return http.StatusOK, nil
+}
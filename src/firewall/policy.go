@@ -0,0 +1,163 @@
+package firewall
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Binding lists who a named policy applies to
+type Binding struct {
+	APIKeys []string // API key IDs
+	Users   []string // User IDs
+	Models  []string // Registered model names
+}
+
+// Policies holds the default firewall config and the named policies bound to
+// API keys, users and registered models
+type Policies struct {
+	Default  Config
+	Named    map[string]Config
+	byAPIKey map[string]string
+	byUser   map[string]string
+	byModel  map[string]string
+}
+
+func NewPolicies(defaultConfig Config) Policies {
+	return Policies{
+		Default:  defaultConfig,
+		Named:    make(map[string]Config),
+		byAPIKey: make(map[string]string),
+		byUser:   make(map[string]string),
+		byModel:  make(map[string]string),
+	}
+}
+
+// Add registers a named policy and its bindings
+func (p *Policies) Add(cfg Config, binding Binding) error {
+	if cfg.Name == "" {
+		return errors.New("policy name cannot be empty")
+	}
+	if cfg.Name == p.Default.Name {
+		return fmt.Errorf("policy %s has the same name as the default config", cfg.Name)
+	}
+	if _, exists := p.Named[cfg.Name]; exists {
+		return fmt.Errorf("policy %s already exists", cfg.Name)
+	}
+
+	for _, key := range binding.APIKeys {
+		if err := bind(p.byAPIKey, key, cfg.Name, true); err != nil {
+			return fmt.Errorf("policy %s: invalid api key binding: %w", cfg.Name, err)
+		}
+	}
+	for _, user := range binding.Users {
+		if err := bind(p.byUser, user, cfg.Name, true); err != nil {
+			return fmt.Errorf("policy %s: invalid user binding: %w", cfg.Name, err)
+		}
+	}
+	for _, model := range binding.Models {
+		if err := bind(p.byModel, model, cfg.Name, false); err != nil {
+			return fmt.Errorf("policy %s: invalid model binding: %w", cfg.Name, err)
+		}
+	}
+
+	p.Named[cfg.Name] = cfg
+	return nil
+}
+
+// CheckBinding reports whether a policy with this name and binding could be
+// added, replacing the named policy's bindings if it already exists. The
+// policies themselves are left unchanged.
+func (p *Policies) CheckBinding(name string, binding Binding) error {
+	candidate := p.clone()
+	if _, exists := candidate.Named[name]; exists {
+		delete(candidate.Named, name)
+		for _, bindings := range []map[string]string{candidate.byAPIKey, candidate.byUser, candidate.byModel} {
+			for key, policy := range bindings {
+				if policy == name {
+					delete(bindings, key)
+				}
+			}
+		}
+	}
+	return candidate.Add(Config{Name: name}, binding)
+}
+
+func (p *Policies) clone() Policies {
+	out := NewPolicies(p.Default)
+	for name, cfg := range p.Named {
+		out.Named[name] = cfg
+	}
+	for key, policy := range p.byAPIKey {
+		out.byAPIKey[key] = policy
+	}
+	for key, policy := range p.byUser {
+		out.byUser[key] = policy
+	}
+	for key, policy := range p.byModel {
+		out.byModel[key] = policy
+	}
+	return out
+}
+
+// AddFirewall appends a firewall to the default config or a named policy
+func (p *Policies) AddFirewall(policy string, firewall Firewall) error {
+	if policy == p.Default.Name {
+		p.Default.Firewalls = append(p.Default.Firewalls, firewall)
+		return nil
+	}
+
+	cfg, exists := p.Named[policy]
+	if !exists {
+		return fmt.Errorf("policy %s does not exist", policy)
+	}
+	cfg.Firewalls = append(cfg.Firewalls, firewall)
+	p.Named[policy] = cfg
+	return nil
+}
+
+// Has reports whether the default config or a named policy has this name
+func (p *Policies) Has(policy string) bool {
+	if policy == p.Default.Name {
+		return true
+	}
+	_, exists := p.Named[policy]
+	return exists
+}
+
+func bind(bindings map[string]string, key string, policy string, isUUID bool) error {
+	if isUUID {
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return err
+		}
+		key = id.String()
+	}
+	if existing, exists := bindings[key]; exists {
+		return fmt.Errorf("%s is already bound to policy %s", key, existing)
+	}
+	bindings[key] = policy
+	return nil
+}
+
+// Resolve picks the policy for a request. The most specific binding wins:
+// API key, then user, then registered model, then the default config.
+func (p *Policies) Resolve(apiKeyID uuid.UUID, userID uuid.UUID, modelName string) *Config {
+	for _, lookup := range []struct {
+		bindings map[string]string
+		key      string
+	}{
+		{p.byAPIKey, apiKeyID.String()},
+		{p.byUser, userID.String()},
+		{p.byModel, modelName},
+	} {
+		if name, exists := lookup.bindings[lookup.key]; exists {
+			cfg := p.Named[name]
+			return &cfg
+		}
+	}
+
+	cfg := p.Default
+	return &cfg
+}
@@ -0,0 +1,119 @@
+package firewall
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	keyA  = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	keyB  = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	userA = uuid.MustParse("00000000-0000-0000-0000-0000000000a1")
+	userB = uuid.MustParse("00000000-0000-0000-0000-0000000000b1")
+)
+
+func testPolicies(t *testing.T) Policies {
+	t.Helper()
+	p := NewPolicies(Config{Name: "default"})
+	for _, named := range []struct {
+		name    string
+		binding Binding
+	}{
+		{"by-key", Binding{APIKeys: []string{keyA.String()}}},
+		{"by-user", Binding{Users: []string{userA.String()}}},
+		{"by-model", Binding{Models: []string{"my-gpt4"}}},
+	} {
+		if err := p.Add(Config{Name: named.name}, named.binding); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestResolve(t *testing.T) {
+	p := testPolicies(t)
+
+	tests := []struct {
+		name   string
+		apiKey uuid.UUID
+		user   uuid.UUID
+		model  string
+		want   string
+	}{
+		{"api key wins over user and model", keyA, userA, "my-gpt4", "by-key"},
+		{"user wins over model", keyB, userA, "my-gpt4", "by-user"},
+		{"model", keyB, userB, "my-gpt4", "by-model"},
+		{"nothing bound", keyB, userB, "other", "default"},
+		{"api key alone", keyA, userB, "other", "by-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Resolve(tt.apiKey, tt.user, tt.model).Name; got != tt.want {
+				t.Errorf("Resolve() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		binding Binding
+		wantErr bool
+	}{
+		{"new policy", "new", Binding{APIKeys: []string{keyB.String()}}, false},
+		{"empty name", "", Binding{}, true},
+		{"default name", "default", Binding{}, true},
+		{"existing name", "by-key", Binding{}, true},
+		{"key already bound", "new", Binding{APIKeys: []string{keyA.String()}}, true},
+		{"key bound in another spelling", "new", Binding{APIKeys: []string{"00000000-0000-0000-0000-00000000000A"}}, true},
+		{"model already bound", "new", Binding{Models: []string{"my-gpt4"}}, true},
+		{"invalid user id", "new", Binding{Users: []string{"not-a-uuid"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPolicies(t)
+			err := p.Add(Config{Name: tt.policy}, tt.binding)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckBinding(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		binding Binding
+		wantErr bool
+	}{
+		{"new policy with free bindings", "new", Binding{Users: []string{userB.String()}}, false},
+		{"new policy overlapping another", "new", Binding{Users: []string{userA.String()}}, true},
+		{"existing policy keeping its bindings", "by-key", Binding{APIKeys: []string{keyA.String()}}, false},
+		{"existing policy moving its bindings", "by-key", Binding{APIKeys: []string{keyB.String()}}, false},
+		{"existing policy taking another's binding", "by-key", Binding{Models: []string{"my-gpt4"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPolicies(t)
+			err := p.CheckBinding(tt.policy, tt.binding)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckBinding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// The policies themselves are never changed
+			if got := p.Resolve(keyA, userB, "other").Name; got != "by-key" {
+				t.Errorf("after CheckBinding, key A resolves to %s, want by-key", got)
+			}
+			if _, exists := p.Named["new"]; exists {
+				t.Error("CheckBinding added the policy")
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package firewall
+
+import (
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"covalence/src/internal"
+	"covalence/src/request"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// NotifyChannel is the channel the firewall_policies and firewall_configs
+// triggers notify on
+const NotifyChannel = "firewall_config"
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("policy already exists")
+	ErrInUse    = errors.New("policy still has firewalls")
+)
+
+// StoredPolicy is a policy as saved in Postgres
+type StoredPolicy struct {
+	Name      string
+	APIKeys   []string
+	Users     []string
+	Models    []string
+	Version   int32
+	Deleted   bool
+	ChangedBy string
+	ChangedAt time.Time
+}
+
+// StoredFirewall is a firewall as saved in Postgres
+type StoredFirewall struct {
+	ID                string
+	Policy            string
+	Enabled           bool
+	Type              string
+	Mode              string
+	Model             string
+	BlockingThreshold float32
+	Version           int32
+	Deleted           bool
+	ChangedBy         string
+	ChangedAt         time.Time
+}
+
+// LoadStoredPolicies adds the policies and firewalls saved in Postgres on top of
+// the ones read from config.yaml. A saved policy or firewall that can't be
+// added is logged and skipped, so one bad row doesn't stop the rest loading.
+func LoadStoredPolicies(ctx context.Context, db *postgres.DB, policies *Policies, models []internal.Model) error {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	storedPolicies, err := db.Queries.ListFirewallPolicies(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall policies: %w", err)
+	}
+
+	for _, sp := range storedPolicies {
+		err := policies.Add(Config{Name: sp.Name}, Binding{
+			APIKeys: uuidStrings(sp.ApiKeys),
+			Users:   uuidStrings(sp.Users),
+			Models:  sp.Models,
+		})
+		if err != nil {
+			log.Printf("skipping stored firewall policy %s: %v", sp.Name, err)
+		}
+	}
+
+	storedFirewalls, err := db.Queries.ListFirewallConfigs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list firewall configs: %w", err)
+	}
+
+	for _, sf := range storedFirewalls {
+		firewall, err := parseFirewall(rawFirewall{
+			ID:                sf.FirewallID.String(),
+			Enabled:           sf.Enabled,
+			Type:              sf.Type,
+			Mode:              sf.Mode,
+			Model:             sf.Model,
+			BlockingThreshold: sf.BlockingThreshold,
+		}, models)
+		if err != nil {
+			log.Printf("skipping stored firewall %s: %v", sf.FirewallID.String(), err)
+			continue
+		}
+		firewall.Version = sf.Version
+
+		if err := policies.AddFirewall(sf.PolicyName, firewall); err != nil {
+			log.Printf("skipping stored firewall %s: %v", sf.FirewallID.String(), err)
+		}
+	}
+
+	return nil
+}
+
+// CreatePolicy saves a new policy. A deleted policy with the same name is
+// revived, continuing its version history.
+func CreatePolicy(ctx context.Context, db *postgres.DB, p request.Policy, changedBy string) (StoredPolicy, error) {
+	stored, err := writePolicy(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallPolicy, error) {
+		return q.CreateFirewallPolicy(ctx, sqlc.CreateFirewallPolicyParams(policyParams(p)))
+	})
+	// No row comes back when a policy with this name is still live
+	if errors.Is(err, ErrNotFound) {
+		return StoredPolicy{}, ErrExists
+	}
+	return stored, err
+}
+
+// UpdatePolicy replaces the bindings of a saved policy
+func UpdatePolicy(ctx context.Context, db *postgres.DB, p request.Policy, changedBy string) (StoredPolicy, error) {
+	return writePolicy(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallPolicy, error) {
+		return q.UpdateFirewallPolicy(ctx, policyParams(p))
+	})
+}
+
+// DeletePolicy removes a saved policy; its firewalls must be deleted first
+func DeletePolicy(ctx context.Context, db *postgres.DB, name string, changedBy string) (StoredPolicy, error) {
+	return writePolicy(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallPolicy, error) {
+		count, err := q.CountPolicyFirewalls(ctx, name)
+		if err != nil {
+			return sqlc.FirewallPolicy{}, err
+		}
+		if count > 0 {
+			return sqlc.FirewallPolicy{}, ErrInUse
+		}
+		return q.DeleteFirewallPolicy(ctx, name)
+	})
+}
+
+// PolicyVersions returns every saved version of a policy, oldest first
+func PolicyVersions(ctx context.Context, db *postgres.DB, name string) ([]StoredPolicy, error) {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	rows, err := db.Queries.ListFirewallPolicyVersions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]StoredPolicy, 0, len(rows))
+	for _, r := range rows {
+		versions = append(versions, StoredPolicy{
+			Name:      r.Name,
+			APIKeys:   uuidStrings(r.ApiKeys),
+			Users:     uuidStrings(r.Users),
+			Models:    r.Models,
+			Version:   r.Version,
+			Deleted:   r.Deleted,
+			ChangedBy: r.ChangedBy,
+			ChangedAt: r.ChangedAt.Time,
+		})
+	}
+
+	return versions, nil
+}
+
+// CreateFirewall saves a new firewall
+func CreateFirewall(ctx context.Context, db *postgres.DB, f request.Firewall, changedBy string) (StoredFirewall, error) {
+	return writeFirewall(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallConfig, error) {
+		return q.CreateFirewallConfig(ctx, sqlc.CreateFirewallConfigParams{
+			PolicyName:        f.Policy.String(),
+			Enabled:           f.Enabled,
+			Type:              f.Type.String(),
+			Mode:              f.Mode.String(),
+			Model:             f.Model.String(),
+			BlockingThreshold: f.BlockingThreshold,
+		})
+	})
+}
+
+// UpdateFirewall replaces a saved firewall
+func UpdateFirewall(ctx context.Context, db *postgres.DB, id uuid.UUID, f request.Firewall, changedBy string) (StoredFirewall, error) {
+	return writeFirewall(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallConfig, error) {
+		return q.UpdateFirewallConfig(ctx, sqlc.UpdateFirewallConfigParams{
+			FirewallID:        pgUUID(id),
+			PolicyName:        f.Policy.String(),
+			Enabled:           f.Enabled,
+			Type:              f.Type.String(),
+			Mode:              f.Mode.String(),
+			Model:             f.Model.String(),
+			BlockingThreshold: f.BlockingThreshold,
+		})
+	})
+}
+
+// SetFirewallEnabled enables or disables a saved firewall
+func SetFirewallEnabled(ctx context.Context, db *postgres.DB, id uuid.UUID, enabled bool, changedBy string) (StoredFirewall, error) {
+	return writeFirewall(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallConfig, error) {
+		current, err := q.GetFirewallConfig(ctx, pgUUID(id))
+		if err != nil {
+			return sqlc.FirewallConfig{}, err
+		}
+		return q.UpdateFirewallConfig(ctx, sqlc.UpdateFirewallConfigParams{
+			FirewallID:        current.FirewallID,
+			PolicyName:        current.PolicyName,
+			Enabled:           enabled,
+			Type:              current.Type,
+			Mode:              current.Mode,
+			Model:             current.Model,
+			BlockingThreshold: current.BlockingThreshold,
+		})
+	})
+}
+
+// DeleteFirewall removes a saved firewall
+func DeleteFirewall(ctx context.Context, db *postgres.DB, id uuid.UUID, changedBy string) (StoredFirewall, error) {
+	return writeFirewall(ctx, db, changedBy, func(q *sqlc.Queries) (sqlc.FirewallConfig, error) {
+		return q.DeleteFirewallConfig(ctx, pgUUID(id))
+	})
+}
+
+// FirewallVersions returns every saved version of a firewall, oldest first
+func FirewallVersions(ctx context.Context, db *postgres.DB, id uuid.UUID) ([]StoredFirewall, error) {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	rows, err := db.Queries.ListFirewallConfigVersions(ctx, pgUUID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]StoredFirewall, 0, len(rows))
+	for _, r := range rows {
+		versions = append(versions, StoredFirewall{
+			ID:                r.FirewallID.String(),
+			Policy:            r.PolicyName,
+			Enabled:           r.Enabled,
+			Type:              r.Type,
+			Mode:              r.Mode,
+			Model:             r.Model,
+			BlockingThreshold: r.BlockingThreshold,
+			Version:           r.Version,
+			Deleted:           r.Deleted,
+			ChangedBy:         r.ChangedBy,
+			ChangedAt:         r.ChangedAt.Time,
+		})
+	}
+
+	return versions, nil
+}
+
+// writePolicy runs a policy change and records the resulting version in one transaction
+func writePolicy(ctx context.Context, db *postgres.DB, changedBy string, write func(*sqlc.Queries) (sqlc.FirewallPolicy, error)) (StoredPolicy, error) {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return StoredPolicy{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := db.Queries.WithTx(tx)
+
+	p, err := write(q)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StoredPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return StoredPolicy{}, err
+	}
+
+	err = q.InsertFirewallPolicyVersion(ctx, sqlc.InsertFirewallPolicyVersionParams{
+		Name:      p.Name,
+		Version:   p.Version,
+		ApiKeys:   p.ApiKeys,
+		Users:     p.Users,
+		Models:    p.Models,
+		Deleted:   p.Deleted,
+		ChangedBy: changedBy,
+	})
+	if err != nil {
+		return StoredPolicy{}, fmt.Errorf("failed to record policy version: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return StoredPolicy{}, err
+	}
+
+	return StoredPolicy{
+		Name:      p.Name,
+		APIKeys:   uuidStrings(p.ApiKeys),
+		Users:     uuidStrings(p.Users),
+		Models:    p.Models,
+		Version:   p.Version,
+		Deleted:   p.Deleted,
+		ChangedBy: changedBy,
+		ChangedAt: p.UpdatedAt.Time,
+	}, nil
+}
+
+// writeFirewall runs a firewall change and records the resulting version in one transaction
+func writeFirewall(ctx context.Context, db *postgres.DB, changedBy string, write func(*sqlc.Queries) (sqlc.FirewallConfig, error)) (StoredFirewall, error) {
+	db.Mu.Lock()
+	defer db.Mu.Unlock()
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return StoredFirewall{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := db.Queries.WithTx(tx)
+
+	f, err := write(q)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return StoredFirewall{}, ErrNotFound
+	}
+	if err != nil {
+		return StoredFirewall{}, err
+	}
+
+	err = q.InsertFirewallConfigVersion(ctx, sqlc.InsertFirewallConfigVersionParams{
+		FirewallID:        f.FirewallID,
+		Version:           f.Version,
+		PolicyName:        f.PolicyName,
+		Enabled:           f.Enabled,
+		Type:              f.Type,
+		Mode:              f.Mode,
+		Model:             f.Model,
+		BlockingThreshold: f.BlockingThreshold,
+		Deleted:           f.Deleted,
+		ChangedBy:         changedBy,
+	})
+	if err != nil {
+		return StoredFirewall{}, fmt.Errorf("failed to record firewall version: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return StoredFirewall{}, err
+	}
+
+	return StoredFirewall{
+		ID:                f.FirewallID.String(),
+		Policy:            f.PolicyName,
+		Enabled:           f.Enabled,
+		Type:              f.Type,
+		Mode:              f.Mode,
+		Model:             f.Model,
+		BlockingThreshold: f.BlockingThreshold,
+		Version:           f.Version,
+		Deleted:           f.Deleted,
+		ChangedBy:         changedBy,
+		ChangedAt:         f.UpdatedAt.Time,
+	}, nil
+}
+
+// PolicyBinding is the binding a policy change asks for
+func PolicyBinding(p request.Policy) Binding {
+	binding := Binding{}
+	for _, id := range p.APIKeys {
+		binding.APIKeys = append(binding.APIKeys, id.String())
+	}
+	for _, id := range p.Users {
+		binding.Users = append(binding.Users, id.String())
+	}
+	for _, m := range p.Models {
+		binding.Models = append(binding.Models, m.String())
+	}
+	return binding
+}
+
+func policyParams(p request.Policy) sqlc.UpdateFirewallPolicyParams {
+	params := sqlc.UpdateFirewallPolicyParams{
+		Name:    p.Name.String(),
+		ApiKeys: []pgtype.UUID{},
+		Users:   []pgtype.UUID{},
+		Models:  []string{},
+	}
+	for _, id := range p.APIKeys {
+		params.ApiKeys = append(params.ApiKeys, pgUUID(id))
+	}
+	for _, id := range p.Users {
+		params.Users = append(params.Users, pgUUID(id))
+	}
+	for _, m := range p.Models {
+		params.Models = append(params.Models, m.String())
+	}
+	return params
+}
+
+func pgUUID(id uuid.UUID) pgtype.UUID {
+	return pgtype.UUID{Bytes: id, Valid: true}
+}
+
+func uuidStrings(ids []pgtype.UUID) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, id.String())
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package embedding
+
+import (
+	"bytes"
+	"covalence/src/internal"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+var (
+	API_URL = "http://localhost:8000/api/v1/models/text/embedding"
+)
+
+// Request asks the internal model service to embed a text
+type Request struct {
+	Model internal.Model
+	Text  string
+}
+
+type Response struct {
+	Embedding []float32 `json:"embedding"`
+	ModelID   string    `json:"model_id"`
+}
+
+func NewRequest(model internal.Model, text string) (Request, error) {
+	if text == "" {
+		return Request{}, errors.New("text cannot be empty")
+	}
+
+	return Request{
+		Model: model,
+		Text:  text,
+	}, nil
+}
+
+func (m Request) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"model": m.Model.Model.String(),
+		"text":  m.Text,
+	}
+}
+
+func (m Request) Run() (Response, error) {
+	url := API_URL
+
+	// Marshal the requestMap into JSON
+	jsonData, err := json.Marshal(m.ToMap())
+	if err != nil {
+		return Response{}, errors.New("failed to marshal request map: " + err.Error())
+	}
+
+	log.Printf("sending request to %s", url)
+
+	// Create a new HTTP POST request
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return Response{}, errors.New("failed to create HTTP request: " + err.Error())
+	}
+
+	// Set the appropriate headers
+	req.Header.Set("Content-Type", "application/json")
+
+	// Execute the HTTP request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Response{}, errors.New("failed to execute HTTP request: " + err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, errors.New("received non-OK HTTP status: " + resp.Status)
+	}
+
+	// Decode the response body into a Response struct
+	var response Response
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return Response{}, errors.New("failed to decode response body: " + err.Error())
+	}
+
+	if len(response.Embedding) == 0 {
+		return Response{}, errors.New("received an empty embedding")
+	}
+
+	return response, nil
+}
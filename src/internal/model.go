@@ -3,6 +3,7 @@ package internal
 import (
 	"covalence/src/types"
 	"errors"
+	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -17,66 +18,85 @@ type Model struct {
 
 var (
 	models     []Model
+	modelsMu   sync.RWMutex
 	modelsOnce sync.Once
 )
 
 // LoadModels reads the models.yaml file, parses it into a list of Model structs, and saves it.
 func LoadModels(filePath string) {
 	modelsOnce.Do(func() {
-		data, err := os.ReadFile(filePath)
+		parsedModels, err := ReadModels(filePath)
 		if err != nil {
-			log.Fatalf("failed to read file: %v", err)
+			log.Fatalf("failed to load models: %v", err)
 		}
 
-		var rawModels []struct {
-			Model string `yaml:"model"`
-			Type  string `yaml:"type"`
-		}
+		SetModels(parsedModels)
+	})
+}
+
+// ReadModels reads and validates a models file without touching the loaded models.
+func ReadModels(filePath string) ([]Model, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var rawModels []struct {
+		Model string `yaml:"model"`
+		Type  string `yaml:"type"`
+	}
+
+	if err := yaml.Unmarshal(data, &rawModels); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
 
-		if err := yaml.Unmarshal(data, &rawModels); err != nil {
-			log.Fatalf("failed to parse YAML: %v", err)
+	var parsedModels []Model
+	for _, rawModel := range rawModels {
+		model, err := types.NewModelID(rawModel.Model)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model: %w", err)
 		}
 
-		var parsedModels []Model
-		for _, rawModel := range rawModels {
-			model, err := types.NewModelID(rawModel.Model)
-			if err != nil {
-				log.Fatalf("failed to parse model: %v", err)
-				continue
-			}
-
-			modelType, err := types.NewInternalModelType(rawModel.Type)
-			if err != nil {
-				log.Fatalf("failed to parse model type: %v", err)
-				continue
-			}
-
-			parsedModels = append(parsedModels, Model{
-				Model: model,
-				Type:  modelType,
-			})
+		modelType, err := types.NewInternalModelType(rawModel.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse model type: %w", err)
 		}
 
-		models = parsedModels
-	})
+		parsedModels = append(parsedModels, Model{
+			Model: model,
+			Type:  modelType,
+		})
+	}
+
+	return parsedModels, nil
+}
+
+// SetModels replaces the loaded models.
+func SetModels(m []Model) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models = m
 }
 
 func CheckModelExists(model types.ModelID) bool {
-	for _, m := range models {
-		if m.Model == model {
-			return true
-		}
-	}
-	return false
+	_, err := GetModel(model)
+	return err == nil
 }
 
 // GetModels returns the loaded models.
 func GetModels() []Model {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
 	return models
 }
 
-// GetModels returns the loaded models.
+// GetModel returns a loaded model by ID.
 func GetModel(model types.ModelID) (Model, error) {
+	return FindModel(GetModels(), model)
+}
+
+// FindModel looks up a model by ID in the given list.
+func FindModel(models []Model, model types.ModelID) (Model, error) {
 	for _, m := range models {
 		if m.Model == model {
 			return m, nil
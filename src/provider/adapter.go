@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"covalence/src/request"
+	"covalence/src/types"
+	"io"
+	"net/http"
+)
+
+// Adapter translates between the OpenAI chat-completions format clients speak
+// and a provider's own API
+type Adapter interface {
+	// Path maps the client's path to the provider's path
+	Path(path string) string
+	// Body builds the provider request body
+	Body(g request.Generate) map[string]interface{}
+	// Headers sets the provider's authentication and version headers
+	Headers(h http.Header, apiKey string)
+	// Response converts a successful non-streaming response into OpenAI format
+	Response(body []byte) ([]byte, error)
+	// Stream wraps w so that provider server-sent events are written as OpenAI chunks
+	Stream(w io.Writer) io.Writer
+}
+
+// For returns the adapter for a provider. Providers without their own adapter
+// are assumed to be OpenAI compatible.
+func For(p types.ModelProvider) Adapter {
+	switch p.String() {
+	case "anthropic":
+		return anthropic{}
+	default:
+		return openAI{}
+	}
+}
+
+// OpenAICompatible reports whether a provider takes OpenAI requests unchanged.
+// Endpoints other than chat completions are only proxied to these providers.
+func OpenAICompatible(p types.ModelProvider) bool {
+	_, ok := For(p).(openAI)
+	return ok
+}
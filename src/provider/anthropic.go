@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"bytes"
+	"covalence/src/request"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 4096 // The Messages API requires max_tokens
+)
+
+// anthropic translates to and from the native Messages API
+type anthropic struct{}
+
+func (anthropic) Path(path string) string {
+	if strings.HasSuffix(path, "/chat/completions") {
+		return strings.TrimSuffix(path, "/chat/completions") + "/messages"
+	}
+	return path
+}
+
+func (anthropic) Body(g request.Generate) map[string]interface{} {
+	messages := make([]map[string]string, 0, len(g.Messages))
+	for _, msg := range g.Messages {
+		messages = append(messages, msg.ToMap())
+	}
+
+	body := map[string]interface{}{
+		"model":      g.Target.Model.String(),
+		"messages":   messages,
+		"stream":     g.IsStreaming,
+		"max_tokens": anthropicMaxTokens,
+	}
+
+	for name, value := range g.Parameters() {
+		body[name] = value
+	}
+
+	return body
+}
+
+func (anthropic) Headers(h http.Header, apiKey string) {
+	h.Del("Authorization")
+	if apiKey != "" {
+		h.Set("x-api-key", apiKey)
+	}
+	if h.Get("Anthropic-Version") == "" {
+		h.Set("Anthropic-Version", anthropicVersion)
+	}
+}
+
+type anthropicResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (anthropic) Response(body []byte) ([]byte, error) {
+	var r anthropicResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("invalid anthropic response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range r.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":      r.ID,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   r.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": content.String()},
+			"finish_reason": finishReason(r.StopReason),
+		}},
+		"usage": map[string]int{
+			"prompt_tokens":     r.Usage.InputTokens,
+			"completion_tokens": r.Usage.OutputTokens,
+			"total_tokens":      r.Usage.InputTokens + r.Usage.OutputTokens,
+		},
+	})
+}
+
+func (anthropic) Stream(w io.Writer) io.Writer {
+	return &anthropicStream{out: w, created: time.Now().Unix()}
+}
+
+// anthropicStream rewrites Messages API events as chat.completion.chunk events
+type anthropicStream struct {
+	out          io.Writer
+	buf          []byte
+	id           string
+	model        string
+	created      int64
+	inputTokens  int
+	outputTokens int
+}
+
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (s *anthropicStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(s.buf[:i]))
+		s.buf = s.buf[i+1:]
+
+		if !strings.HasPrefix(line, "data:") {
+			continue // event names are repeated in the data type
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			continue
+		}
+
+		if err := s.handle(event); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (s *anthropicStream) handle(event anthropicEvent) error {
+	switch event.Type {
+	case "message_start":
+		s.id = event.Message.ID
+		s.model = event.Message.Model
+		s.inputTokens = event.Message.Usage.InputTokens
+		return s.chunk(map[string]string{"role": "assistant", "content": ""}, nil, nil)
+
+	case "content_block_delta":
+		if event.Delta.Type != "text_delta" {
+			return nil
+		}
+		return s.chunk(map[string]string{"content": event.Delta.Text}, nil, nil)
+
+	case "message_delta":
+		s.outputTokens = event.Usage.OutputTokens
+		reason := finishReason(event.Delta.StopReason)
+		return s.chunk(map[string]string{}, &reason, map[string]int{
+			"prompt_tokens":     s.inputTokens,
+			"completion_tokens": s.outputTokens,
+			"total_tokens":      s.inputTokens + s.outputTokens,
+		})
+
+	case "message_stop":
+		_, err := io.WriteString(s.out, "data: [DONE]\n\n")
+		return err
+	}
+
+	return nil
+}
+
+func (s *anthropicStream) chunk(delta map[string]string, reason *string, usage map[string]int) error {
+	chunk := map[string]interface{}{
+		"id":      s.id,
+		"object":  "chat.completion.chunk",
+		"created": s.created,
+		"model":   s.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": reason,
+		}},
+	}
+	if usage != nil {
+		chunk["usage"] = usage
+	}
+
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "data: %s\n\n", data)
+	return err
+}
+
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// events parses the data lines of a chat.completion.chunk stream, dropping
+// the created timestamp so chunks compare by content
+func events(t *testing.T, body string) []interface{} {
+	t.Helper()
+	var out []interface{}
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := strings.TrimPrefix(line, "data: ")
+		if data == "[DONE]" {
+			out = append(out, data)
+			continue
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %q: %v", data, err)
+		}
+		delete(chunk, "created")
+		out = append(out, chunk)
+	}
+	return out
+}
+
+func TestAnthropicStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		split int // write the body in pieces of this size, 0 for one write
+		want  string
+	}{
+		{
+			name: "text",
+			body: `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","model":"claude-3-5-sonnet","usage":{"input_tokens":10}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`,
+			want: `[
+				{"id":"msg_1","object":"chat.completion.chunk","model":"claude-3-5-sonnet","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]},
+				{"id":"msg_1","object":"chat.completion.chunk","model":"claude-3-5-sonnet","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]},
+				{"id":"msg_1","object":"chat.completion.chunk","model":"claude-3-5-sonnet","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":null}]},
+				{"id":"msg_1","object":"chat.completion.chunk","model":"claude-3-5-sonnet","choices":[{"index":0,"delta":{},"finish_reason":"stop"}],
+					"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}},
+				"[DONE]"
+			]`,
+		},
+		{
+			name: "split across writes",
+			body: `data: {"type":"message_start","message":{"id":"msg_2","model":"claude-3-haiku","usage":{"input_tokens":3}}}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}
+data: {"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":1}}
+data: {"type":"message_stop"}
+`,
+			split: 7,
+			want: `[
+				{"id":"msg_2","object":"chat.completion.chunk","model":"claude-3-haiku","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]},
+				{"id":"msg_2","object":"chat.completion.chunk","model":"claude-3-haiku","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}]},
+				{"id":"msg_2","object":"chat.completion.chunk","model":"claude-3-haiku","choices":[{"index":0,"delta":{},"finish_reason":"length"}],
+					"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}},
+				"[DONE]"
+			]`,
+		},
+		{
+			name: "tool use deltas and pings are skipped",
+			body: `data: {"type":"message_start","message":{"id":"msg_3","model":"claude-3-opus","usage":{"input_tokens":4}}}
+data: {"type":"ping"}
+data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\""}}
+data: not json
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}
+`,
+			want: `[
+				{"id":"msg_3","object":"chat.completion.chunk","model":"claude-3-opus","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]},
+				{"id":"msg_3","object":"chat.completion.chunk","model":"claude-3-opus","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],
+					"usage":{"prompt_tokens":4,"completion_tokens":5,"total_tokens":9}}
+			]`,
+		},
+		{
+			name: "incomplete line is held back",
+			body: `data: {"type":"message_start","message":{"id":"msg_4"`,
+			want: `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := anthropic{}.Stream(&out)
+
+			body := []byte(tt.body)
+			size := tt.split
+			if size == 0 {
+				size = len(body)
+			}
+			for len(body) > 0 {
+				n := size
+				if n > len(body) {
+					n = len(body)
+				}
+				written, err := w.Write(body[:n])
+				if err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+				if written != n {
+					t.Fatalf("Write returned %d, want %d", written, n)
+				}
+				body = body[n:]
+			}
+
+			var want []interface{}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if got := events(t, out.String()); !reflect.DeepEqual(got, want) {
+				t.Errorf("Stream() =\n%s\nwant\n%v", out.String(), want)
+			}
+		})
+	}
+}
+
+func TestAnthropicResponse(t *testing.T) {
+	body := `{"id":"msg_1","model":"claude-3-5-sonnet","stop_reason":"end_turn",
+		"content":[{"type":"text","text":"Hello"},{"type":"tool_use","id":"tu_1"},{"type":"text","text":" there"}],
+		"usage":{"input_tokens":7,"output_tokens":3}}`
+
+	data, err := anthropic{}.Response([]byte(body))
+	if err != nil {
+		t.Fatalf("Response: %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	delete(got, "created")
+
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"id":"msg_1","object":"chat.completion","model":"claude-3-5-sonnet",
+		"choices":[{"index":0,"message":{"role":"assistant","content":"Hello there"},"finish_reason":"stop"}],
+		"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Response() = %s", data)
+	}
+
+	if _, err := (anthropic{}).Response([]byte("not json")); err == nil {
+		t.Error("Response(invalid) returned no error")
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"max_tokens":    "length",
+		"tool_use":      "tool_calls",
+		"":              "stop",
+	}
+	for in, want := range tests {
+		if got := finishReason(in); got != want {
+			t.Errorf("finishReason(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
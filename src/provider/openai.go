@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"covalence/src/request"
+	"io"
+	"net/http"
+)
+
+// openAI passes requests and responses through unchanged
+type openAI struct{}
+
+func (openAI) Path(path string) string {
+	return path
+}
+
+func (openAI) Body(g request.Generate) map[string]interface{} {
+	body := g.ToMap()
+
+	// OpenAI only reports usage for chat and completion streams when asked to.
+	// Responses API streams always end with it.
+	if g.IsStreaming && g.Target.Provider.String() == "openai" && g.Format != request.FormatResponses {
+		body["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	return body
+}
+
+func (openAI) Headers(h http.Header, apiKey string) {
+	if apiKey != "" {
+		h.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+func (openAI) Response(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (openAI) Stream(w io.Writer) io.Writer {
+	return w
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scope is what a rule counts requests by
+type Scope string
+
+const (
+	ScopeAPIKey Scope = "api_key"
+	ScopeUser   Scope = "user"
+	ScopeModel  Scope = "model"
+)
+
+// Wildcard matches every API key, user or model, each counted separately
+const Wildcard = "*"
+
+// Rule limits requests and estimated tokens per minute. A limit of 0 is unlimited.
+type Rule struct {
+	Name              string
+	Scope             Scope
+	Match             string // API key ID, user ID or model alias, or * for each one
+	RequestsPerMinute int64
+	TokensPerMinute   int64
+}
+
+// Config holds the rate limit rules
+type Config struct {
+	Shared bool // Count in Postgres so limits hold across instances
+	Rules  []Rule
+}
+
+type rawRule struct {
+	Name              string `yaml:"name"`
+	Scope             string `yaml:"scope"`
+	Match             string `yaml:"match"`
+	RequestsPerMinute int64  `yaml:"requests_per_minute"`
+	TokensPerMinute   int64  `yaml:"tokens_per_minute"`
+}
+
+type rawConfig struct {
+	RateLimits struct {
+		Shared bool      `yaml:"shared"`
+		Rules  []rawRule `yaml:"rules"`
+	} `yaml:"rate_limits"`
+}
+
+// ReadConfig reads the rate_limits section of a config file. Without one, nothing is limited.
+func ReadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var raw rawConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Config{Shared: raw.RateLimits.Shared}
+	names := make(map[string]bool)
+	for _, rr := range raw.RateLimits.Rules {
+		rule, err := parseRule(rr)
+		if err != nil {
+			return Config{}, fmt.Errorf("rate limit %s: %w", rr.Name, err)
+		}
+		if names[rule.Name] {
+			return Config{}, fmt.Errorf("rate limit %s is defined twice", rule.Name)
+		}
+		names[rule.Name] = true
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+
+	return cfg, nil
+}
+
+func parseRule(rr rawRule) (Rule, error) {
+	if rr.Name == "" {
+		return Rule{}, errors.New("name is required")
+	}
+
+	scope := Scope(rr.Scope)
+	if scope != ScopeAPIKey && scope != ScopeUser && scope != ScopeModel {
+		return Rule{}, fmt.Errorf("invalid scope %q (must be api_key, user or model)", rr.Scope)
+	}
+
+	if rr.RequestsPerMinute < 0 || rr.TokensPerMinute < 0 {
+		return Rule{}, errors.New("limits cannot be negative")
+	}
+	if rr.RequestsPerMinute == 0 && rr.TokensPerMinute == 0 {
+		return Rule{}, errors.New("requests_per_minute or tokens_per_minute is required")
+	}
+
+	match := rr.Match
+	if match == "" {
+		match = Wildcard
+	}
+
+	return Rule{
+		Name:              rr.Name,
+		Scope:             scope,
+		Match:             match,
+		RequestsPerMinute: rr.RequestsPerMinute,
+		TokensPerMinute:   rr.TokensPerMinute,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"context"
+	"covalence/src/db/postgres"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Subject is who and what a request is counted against
+type Subject struct {
+	APIKeyID string
+	UserID   string
+	Model    string
+}
+
+// Result is the outcome of a rate limit check
+type Result struct {
+	Allowed bool
+	Rule    string // Rule that rejected the request
+	Limit   Usage  // Tightest limits that apply, 0 when unlimited
+	Remain  Usage
+	Reset   time.Time
+}
+
+// Limiter enforces rate limit rules with fixed one-minute windows
+type Limiter struct {
+	memory *memoryStore
+	shared *postgresStore // nil without a database
+}
+
+// NewLimiter creates a limiter. db is used for rules when the config is shared.
+func NewLimiter(db *postgres.DB) *Limiter {
+	l := &Limiter{memory: newMemoryStore()}
+	if db != nil {
+		l.shared = &postgresStore{db: db}
+	}
+	return l
+}
+
+// Allow counts one request and its estimated tokens against every matching
+// rule. If any rule is exceeded the request is rejected and nothing is counted.
+func (l *Limiter) Allow(ctx context.Context, cfg Config, subject Subject, tokens int64) (Result, error) {
+	now := time.Now()
+	window := now.Truncate(time.Minute)
+
+	result := Result{
+		Allowed: true,
+		Remain:  Usage{Requests: math.MaxInt64, Tokens: math.MaxInt64},
+		Reset:   window.Add(time.Minute),
+	}
+
+	var s store = l.memory
+	if cfg.Shared && l.shared != nil {
+		s = l.shared
+	}
+
+	cost := Usage{Requests: 1, Tokens: tokens}
+	var taken []string
+	for _, rule := range cfg.Rules {
+		bucket, ok := rule.bucket(subject)
+		if !ok {
+			continue
+		}
+
+		used, err := s.add(ctx, bucket, window, cost)
+		if err != nil {
+			l.refund(ctx, s, taken, window, cost)
+			return Result{}, fmt.Errorf("failed to count rate limit %s: %w", rule.Name, err)
+		}
+		taken = append(taken, bucket)
+
+		exceeded := (rule.RequestsPerMinute > 0 && used.Requests > rule.RequestsPerMinute) ||
+			(rule.TokensPerMinute > 0 && used.Tokens > rule.TokensPerMinute)
+		if exceeded {
+			l.refund(ctx, s, taken, window, cost)
+			used.Requests -= cost.Requests
+			used.Tokens -= cost.Tokens
+			result.Allowed = false
+			result.Rule = rule.Name
+		}
+
+		result.tighten(rule, used)
+
+		if exceeded {
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// refund takes a rejected request's cost back off the given buckets
+func (l *Limiter) refund(ctx context.Context, s store, buckets []string, window time.Time, cost Usage) {
+	for _, bucket := range buckets {
+		s.add(ctx, bucket, window, Usage{Requests: -cost.Requests, Tokens: -cost.Tokens})
+	}
+}
+
+// bucket names the counter a subject uses for this rule, if the rule applies
+func (r Rule) bucket(subject Subject) (string, bool) {
+	var value string
+	switch r.Scope {
+	case ScopeAPIKey:
+		value = subject.APIKeyID
+	case ScopeUser:
+		value = subject.UserID
+	case ScopeModel:
+		value = subject.Model
+	}
+
+	if value == "" || (r.Match != Wildcard && r.Match != value) {
+		return "", false
+	}
+
+	return r.Name + ":" + value, true
+}
+
+// tighten keeps the lowest remaining requests and tokens across rules
+func (res *Result) tighten(rule Rule, used Usage) {
+	if rule.RequestsPerMinute > 0 {
+		remain := max(rule.RequestsPerMinute-used.Requests, 0)
+		if remain < res.Remain.Requests {
+			res.Remain.Requests = remain
+			res.Limit.Requests = rule.RequestsPerMinute
+		}
+	}
+	if rule.TokensPerMinute > 0 {
+		remain := max(rule.TokensPerMinute-used.Tokens, 0)
+		if remain < res.Remain.Tokens {
+			res.Remain.Tokens = remain
+			res.Limit.Tokens = rule.TokensPerMinute
+		}
+	}
+}
+
+// SetHeaders writes the x-ratelimit-* headers used by OpenAI, plus Retry-After
+// when the request was rejected
+func (res Result) SetHeaders(h http.Header) {
+	reset := fmt.Sprintf("%ds", int(math.Ceil(time.Until(res.Reset).Seconds())))
+
+	if res.Limit.Requests > 0 {
+		h.Set("x-ratelimit-limit-requests", strconv.FormatInt(res.Limit.Requests, 10))
+		h.Set("x-ratelimit-remaining-requests", strconv.FormatInt(res.Remain.Requests, 10))
+		h.Set("x-ratelimit-reset-requests", reset)
+	}
+	if res.Limit.Tokens > 0 {
+		h.Set("x-ratelimit-limit-tokens", strconv.FormatInt(res.Limit.Tokens, 10))
+		h.Set("x-ratelimit-remaining-tokens", strconv.FormatInt(res.Remain.Tokens, 10))
+		h.Set("x-ratelimit-reset-tokens", reset)
+	}
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(res.Reset).Seconds()))))
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	cfg := Config{Rules: []Rule{
+		{Name: "per-key", Scope: ScopeAPIKey, Match: Wildcard, RequestsPerMinute: 2},
+		{Name: "per-model", Scope: ScopeModel, Match: "gpt-4o", TokensPerMinute: 100},
+	}}
+
+	// Run in order against one limiter, within one window
+	steps := []struct {
+		name        string
+		apiKey      string
+		tokens      int64
+		wantAllowed bool
+		wantRule    string
+		wantRemain  Usage
+	}{
+		{name: "first request", apiKey: "a", tokens: 10, wantAllowed: true, wantRemain: Usage{Requests: 1, Tokens: 90}},
+		{name: "second request", apiKey: "a", tokens: 10, wantAllowed: true, wantRemain: Usage{Requests: 0, Tokens: 80}},
+		// Rules after the one exceeded aren't checked
+		{name: "over the key's requests", apiKey: "a", tokens: 10, wantRule: "per-key", wantRemain: Usage{Requests: 0, Tokens: math.MaxInt64}},
+		{name: "another key over the model's tokens", apiKey: "b", tokens: 95, wantRule: "per-model", wantRemain: Usage{Requests: 1, Tokens: 80}},
+		{name: "rejected requests weren't counted", apiKey: "b", tokens: 80, wantAllowed: true, wantRemain: Usage{Requests: 1, Tokens: 0}},
+	}
+
+	limiter := NewLimiter(nil)
+	for _, step := range steps {
+		result, err := limiter.Allow(context.Background(), cfg, Subject{APIKeyID: step.apiKey, Model: "gpt-4o"}, step.tokens)
+		if err != nil {
+			t.Fatalf("%s: Allow() error = %v", step.name, err)
+		}
+		if result.Allowed != step.wantAllowed || result.Rule != step.wantRule {
+			t.Fatalf("%s: Allow() = allowed %v by %q, want allowed %v by %q", step.name, result.Allowed, result.Rule, step.wantAllowed, step.wantRule)
+		}
+		if result.Remain != step.wantRemain {
+			t.Errorf("%s: remaining = %+v, want %+v", step.name, result.Remain, step.wantRemain)
+		}
+	}
+}
+
+func TestMemoryStoreWindows(t *testing.T) {
+	ctx := context.Background()
+	first := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+
+	steps := []struct {
+		bucket string
+		window time.Time
+		want   int64
+	}{
+		{"a", first, 1},
+		{"a", first, 2},
+		{"b", first, 1},
+		{"a", second, 1}, // A new window starts from zero
+		{"a", second, 2},
+		{"b", second, 1},
+	}
+
+	s := newMemoryStore()
+	for i, step := range steps {
+		used, err := s.add(ctx, step.bucket, step.window, Usage{Requests: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used.Requests != step.want {
+			t.Errorf("step %d: %s at %s = %d requests, want %d", i, step.bucket, step.window.Format(time.Kitchen), used.Requests, step.want)
+		}
+	}
+
+	// Counters from the first window are dropped once the second starts
+	if len(s.counters) != 2 {
+		t.Errorf("%d counters kept, want 2", len(s.counters))
+	}
+}
+
+func TestRuleBucket(t *testing.T) {
+	subject := Subject{APIKeyID: "key", UserID: "user", Model: "gpt-4o"}
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		want   string
+		wantOK bool
+	}{
+		{"wildcard key", Rule{Name: "keys", Scope: ScopeAPIKey, Match: Wildcard}, "keys:key", true},
+		{"matching user", Rule{Name: "alice", Scope: ScopeUser, Match: "user"}, "alice:user", true},
+		{"other user", Rule{Name: "bob", Scope: ScopeUser, Match: "bob"}, "", false},
+		{"model", Rule{Name: "models", Scope: ScopeModel, Match: Wildcard}, "models:gpt-4o", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.rule.bucket(subject)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("bucket() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := (Rule{Scope: ScopeUser, Match: Wildcard}).bucket(Subject{}); ok {
+		t.Error("bucket() applied a rule to a subject without a user")
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Usage is a number of requests and tokens
+type Usage struct {
+	Requests int64
+	Tokens   int64
+}
+
+// store adds usage to a bucket's counter for one window and returns the new total
+type store interface {
+	add(ctx context.Context, bucket string, window time.Time, usage Usage) (Usage, error)
+}
+
+// memoryStore counts per instance
+type memoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+	window   time.Time
+}
+
+type counter struct {
+	window time.Time
+	used   Usage
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{counters: make(map[string]*counter)}
+}
+
+func (s *memoryStore) add(_ context.Context, bucket string, window time.Time, usage Usage) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop the previous minute's counters once a new minute starts
+	if window.After(s.window) {
+		for b, c := range s.counters {
+			if c.window.Before(window) {
+				delete(s.counters, b)
+			}
+		}
+		s.window = window
+	}
+
+	c, exists := s.counters[bucket]
+	if !exists || !c.window.Equal(window) {
+		c = &counter{window: window}
+		s.counters[bucket] = c
+	}
+
+	c.used.Requests += usage.Requests
+	c.used.Tokens += usage.Tokens
+
+	return c.used, nil
+}
+
+// postgresStore counts in the rate_limit_counters table. Each add is a single
+// upsert, so concurrent requests and instances can't lose each other's usage.
+type postgresStore struct {
+	db *postgres.DB
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func (s *postgresStore) add(ctx context.Context, bucket string, window time.Time, usage Usage) (Usage, error) {
+	s.prune(ctx, window)
+
+	row, err := s.db.Queries.AddRateLimitUsage(ctx, sqlc.AddRateLimitUsageParams{
+		Bucket:      bucket,
+		WindowStart: pgtype.Timestamptz{Time: window, Valid: true},
+		Requests:    usage.Requests,
+		Tokens:      usage.Tokens,
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+
+	return Usage{Requests: row.Requests, Tokens: row.Tokens}, nil
+}
+
+// prune deletes counters from earlier windows, at most once a minute per instance
+func (s *postgresStore) prune(ctx context.Context, window time.Time) {
+	s.mu.Lock()
+	if !window.After(s.lastPruned) {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPruned = window
+	s.mu.Unlock()
+
+	s.db.Queries.DeleteRateLimitCountersBefore(ctx, pgtype.Timestamptz{Time: window, Valid: true})
+}
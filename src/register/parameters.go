@@ -0,0 +1,82 @@
+package register
+
+import (
+	"covalence/src/types"
+	"errors"
+	"fmt"
+)
+
+// Parameters that rules can be written for
+var ruleParameters = map[string]bool{"temperature": true, "max_tokens": true}
+
+// ParameterRule says how a model takes one request parameter
+type ParameterRule struct {
+	Min    *float64 // Lowest accepted value
+	Max    *float64 // Highest accepted value
+	Rename string   // Send the parameter under this name instead
+	Strip  bool     // Don't send the parameter at all
+}
+
+// ParameterRules maps a parameter name, as clients send it, to its rule
+type ParameterRules map[string]ParameterRule
+
+type rawParameterRule struct {
+	Min    *float64 `yaml:"min"`
+	Max    *float64 `yaml:"max"`
+	Rename string   `yaml:"rename"`
+	Strip  bool     `yaml:"strip"`
+}
+
+// Check returns an error if a value is outside the rule's range
+func (r ParameterRule) Check(name string, value float64) error {
+	if (r.Min != nil && value < *r.Min) || (r.Max != nil && value > *r.Max) {
+		return fmt.Errorf("%s must be %s", name, r.describeRange())
+	}
+	return nil
+}
+
+func (r ParameterRule) describeRange() string {
+	switch {
+	case r.Min != nil && r.Max != nil:
+		return fmt.Sprintf("between %g and %g", *r.Min, *r.Max)
+	case r.Min != nil:
+		return fmt.Sprintf("at least %g", *r.Min)
+	default:
+		return fmt.Sprintf("at most %g", *r.Max)
+	}
+}
+
+func parseParameterRules(raw map[string]rawParameterRule) (ParameterRules, error) {
+	rules := make(ParameterRules, len(raw))
+	for name, rr := range raw {
+		if !ruleParameters[name] {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		if rr.Min != nil && rr.Max != nil && *rr.Min > *rr.Max {
+			return nil, fmt.Errorf("parameter %s: min is greater than max", name)
+		}
+		if rr.Strip && rr.Rename != "" {
+			return nil, errors.New("parameter " + name + ": use either strip or rename")
+		}
+		rules[name] = ParameterRule{Min: rr.Min, Max: rr.Max, Rename: rr.Rename, Strip: rr.Strip}
+	}
+	return rules, nil
+}
+
+// FindParameterRules returns the provider's parameter rules with the model's own
+// rules taking precedence
+func FindParameterRules(providers *[]ModelProvider, provider types.ModelProvider, model types.ModelID) ParameterRules {
+	p, exists := FindModelProvider(providers, provider)
+	if !exists {
+		return ParameterRules{}
+	}
+
+	rules := make(ParameterRules, len(p.Parameters))
+	for name, rule := range p.Parameters {
+		rules[name] = rule
+	}
+	for name, rule := range p.ModelParameters[model] {
+		rules[name] = rule
+	}
+	return rules
+}
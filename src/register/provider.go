@@ -2,66 +2,246 @@ package register
 
 import (
 	"covalence/src/types"
-	"log"
+	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type rawModelProviders struct {
-	Provider string   `yaml:"provider"`
-	Models   []string `yaml:"models"`
-	APIURL   string   `yaml:"api_url"`
+	Provider   string                      `yaml:"provider"`
+	Models     []rawModel                  `yaml:"models"`
+	APIURL     string                      `yaml:"api_url"`
+	APIKeyEnv  string                      `yaml:"api_key_env"`
+	Parameters map[string]rawParameterRule `yaml:"parameters"`
+}
+
+// rawModel is either a model name or a mapping with the model's prices
+type rawModel struct {
+	Name            string  `yaml:"name"`
+	InputPrice      float64 `yaml:"input_price"`
+	OutputPrice     float64 `yaml:"output_price"`
+	ContextWindow   int     `yaml:"context_window"`
+	MaxOutputTokens int     `yaml:"max_output_tokens"`
+
+	Parameters map[string]rawParameterRule `yaml:"parameters"`
+}
+
+func (m *rawModel) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&m.Name)
+	}
+	type plain rawModel
+	return node.Decode((*plain)(m))
 }
 
 type ModelProvider struct {
-	Models   []types.ModelID
-	Provider types.ModelProvider
-	APIURL   types.APIURL
+	Models    []types.ModelID
+	Provider  types.ModelProvider
+	APIURL    types.APIURL
+	APIKeyEnv string // Environment variable holding the key used when failing over to this provider
+	Prices    map[types.ModelID]Price
+	Limits    map[types.ModelID]Limits
+
+	Parameters      ParameterRules                   // Apply to every model of the provider
+	ModelParameters map[types.ModelID]ParameterRules // Override the provider's rules per model
+}
+
+// Limits are a model's token limits. 0 means unknown.
+type Limits struct {
+	ContextWindow   int // Prompt and completion tokens together
+	MaxOutputTokens int
+}
+
+// Price is what a model costs in USD per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Cost returns the USD cost of a request
+func (p Price) Cost(promptTokens, completionTokens int64) float64 {
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
 }
 
 func ReadModelProviders() (*[]ModelProvider, error) {
-	data, err := os.ReadFile("providers.yaml") // or whatever your file is named
+	return LoadModelProviders("providers.yaml")
+}
+
+// LoadModelProviders reads and validates a providers file
+func LoadModelProviders(path string) (*[]ModelProvider, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("error reading file: %v", err)
-		return &[]ModelProvider{}, err
+		return &[]ModelProvider{}, fmt.Errorf("error reading file: %w", err)
 	}
 
 	var rawModelProviders []rawModelProviders
 	err = yaml.Unmarshal(data, &rawModelProviders)
 	if err != nil {
-		log.Fatalf("error unmarshalling YAML: %v", err)
-		return &[]ModelProvider{}, err
+		return &[]ModelProvider{}, fmt.Errorf("error unmarshalling YAML: %w", err)
 	}
 
 	var modelProviders []ModelProvider
 	for _, rawModelProvider := range rawModelProviders {
 		provider, err := types.NewModelProvider(rawModelProvider.Provider)
 		if err != nil {
-			log.Fatalf("error creating provider: %v", err)
-			continue
+			return &[]ModelProvider{}, fmt.Errorf("error creating provider: %w", err)
 		}
 		models := make([]types.ModelID, 0, len(rawModelProvider.Models))
+		prices := make(map[types.ModelID]Price)
+		limits := make(map[types.ModelID]Limits)
+		modelParameters := make(map[types.ModelID]ParameterRules)
 		for _, model := range rawModelProvider.Models {
-			modelID, err := types.NewModelID(model)
+			modelID, err := types.NewModelID(model.Name)
 			if err != nil {
-				log.Fatalf("error creating model ID: %v", err)
-				continue
+				return &[]ModelProvider{}, fmt.Errorf("error creating model ID: %w", err)
+			}
+			if model.InputPrice < 0 || model.OutputPrice < 0 {
+				return &[]ModelProvider{}, fmt.Errorf("negative price for model %s", model.Name)
 			}
 			models = append(models, modelID)
+			if model.InputPrice > 0 || model.OutputPrice > 0 {
+				prices[modelID] = Price{Input: model.InputPrice, Output: model.OutputPrice}
+			}
+			if model.ContextWindow < 0 || model.MaxOutputTokens < 0 {
+				return &[]ModelProvider{}, fmt.Errorf("negative token limit for model %s", model.Name)
+			}
+			if model.ContextWindow > 0 && model.MaxOutputTokens > model.ContextWindow {
+				return &[]ModelProvider{}, fmt.Errorf("max_output_tokens exceeds context_window for model %s", model.Name)
+			}
+			if model.ContextWindow > 0 || model.MaxOutputTokens > 0 {
+				limits[modelID] = Limits{ContextWindow: model.ContextWindow, MaxOutputTokens: model.MaxOutputTokens}
+			}
+			if len(model.Parameters) > 0 {
+				modelParameters[modelID], err = parseParameterRules(model.Parameters)
+				if err != nil {
+					return &[]ModelProvider{}, fmt.Errorf("model %s: %w", model.Name, err)
+				}
+			}
 		}
 		apiURL, err := types.NewAPIURL(rawModelProvider.APIURL)
 		if err != nil {
-			log.Fatalf("error creating API URL: %v", err)
-			continue
+			return &[]ModelProvider{}, fmt.Errorf("error creating API URL: %w", err)
+		}
+
+		parameters, err := parseParameterRules(rawModelProvider.Parameters)
+		if err != nil {
+			return &[]ModelProvider{}, fmt.Errorf("provider %s: %w", rawModelProvider.Provider, err)
 		}
 
 		modelProviders = append(modelProviders, ModelProvider{
-			Models:   models,
-			Provider: provider,
-			APIURL:   apiURL,
+			Models:    models,
+			Provider:  provider,
+			APIURL:    apiURL,
+			APIKeyEnv: rawModelProvider.APIKeyEnv,
+			Prices:    prices,
+			Limits:    limits,
+
+			Parameters:      parameters,
+			ModelParameters: modelParameters,
 		})
 	}
 
 	return &modelProviders, nil
 }
+
+// FindModelProvider returns the providers.yaml entry for a provider
+func FindModelProvider(providers *[]ModelProvider, provider types.ModelProvider) (ModelProvider, bool) {
+	for _, p := range *providers {
+		if p.Provider == provider {
+			return p, true
+		}
+	}
+	return ModelProvider{}, false
+}
+
+// APIKey returns the provider's own API key, or "" when none is configured
+func (p ModelProvider) APIKey() string {
+	if p.APIKeyEnv == "" {
+		return ""
+	}
+	return os.Getenv(p.APIKeyEnv)
+}
+
+// FindPrice returns a model's price, or a zero price when none is configured
+func FindPrice(providers *[]ModelProvider, provider types.ModelProvider, model types.ModelID) Price {
+	p, exists := FindModelProvider(providers, provider)
+	if !exists {
+		return Price{}
+	}
+	return p.Prices[model]
+}
+
+// FindLimits returns a model's token limits, or zero limits when none are configured
+func FindLimits(providers *[]ModelProvider, provider types.ModelProvider, model types.ModelID) Limits {
+	p, exists := FindModelProvider(providers, provider)
+	if !exists {
+		return Limits{}
+	}
+	return p.Limits[model]
+}
+
+// HasModel reports whether the provider offers a model
+func (p ModelProvider) HasModel(model types.ModelID) bool {
+	for _, m := range p.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateModel checks a model against the provider catalog. The custom provider
+// is not in the catalog and accepts any model.
+func ValidateModel(providers *[]ModelProvider, provider types.ModelProvider, model types.ModelID) (ModelProvider, error) {
+	if provider == types.CustomProvider() {
+		return ModelProvider{Provider: provider}, nil
+	}
+
+	p, exists := FindModelProvider(providers, provider)
+	if !exists {
+		return ModelProvider{}, fmt.Errorf("provider %s is not configured in providers.yaml", provider.String())
+	}
+
+	if !p.HasModel(model) {
+		if suggestion, ok := p.closestModel(model); ok {
+			return ModelProvider{}, fmt.Errorf("model %s is not offered by %s (did you mean %s?)", model.String(), provider.String(), suggestion.String())
+		}
+		return ModelProvider{}, fmt.Errorf("model %s is not offered by %s", model.String(), provider.String())
+	}
+
+	return p, nil
+}
+
+// closestModel finds the offered model with the smallest edit distance, if it is close enough to be a typo
+func (p ModelProvider) closestModel(model types.ModelID) (types.ModelID, bool) {
+	best, bestDistance := types.ModelID{}, -1
+	for _, m := range p.Models {
+		d := editDistance(strings.ToLower(model.String()), strings.ToLower(m.String()))
+		if bestDistance == -1 || d < bestDistance {
+			best, bestDistance = m, d
+		}
+	}
+	return best, bestDistance >= 0 && bestDistance <= 2
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr := make([]int, len(b)+1)
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(b)]
+}
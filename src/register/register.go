@@ -1,38 +1,215 @@
 package register
 
 import (
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
 	"covalence/src/user"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrModelNotFound = errors.New("model not found")
+	ErrModelExists   = errors.New("model already exists")
 )
 
 // ModelRegistry stores registered models
 type Registry struct {
-	Mu     sync.RWMutex
-	Models map[string]user.Model
+	Mu      sync.RWMutex
+	Models  map[string]user.Model // Cache of the registered_models table when backed by Postgres
+	db      *postgres.DB
+	writeMu sync.Mutex // Serializes changes, so Mu is only held to swap the cached entry
+}
+
+// Change is one audited change to a registered model
+type Change struct {
+	Name      string
+	Action    string
+	ChangedBy string
+	Before    map[string]interface{}
+	After     map[string]interface{}
+	ChangedAt time.Time
 }
 
-// NewModelRegistry creates a new model registry
+// NewModelRegistry creates a new in-memory model registry
 func NewModelRegistry() *Registry {
 	return &Registry{
 		Models: make(map[string]user.Model),
 	}
 }
 
+// LoadModelRegistry creates a registry backed by Postgres and fills its cache
+func LoadModelRegistry(ctx context.Context, db *postgres.DB) (*Registry, error) {
+	r := NewModelRegistry()
+	r.db = db
+
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
 // RegisterModel adds model information
-func (r *Registry) Register(modelInfo user.Model) error {
-	r.Mu.Lock()
-	defer r.Mu.Unlock()
+func (r *Registry) Register(ctx context.Context, modelInfo user.Model, changedBy string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
 
 	// check if model name already exists
-	if _, exists := r.Models[modelInfo.Name.String()]; exists {
-		return fmt.Errorf("model with name %s already exists", modelInfo.Name.String())
+	if _, exists := r.GetInfo(modelInfo.Name.String()); exists {
+		return fmt.Errorf("%w: %s", ErrModelExists, modelInfo.Name.String())
+	}
+
+	targets, err := targetsJSON(modelInfo.Targets)
+	if err != nil {
+		return err
+	}
+
+	fallbacks, err := targetsJSON(modelInfo.Fallbacks)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, modelInfo.Name.String(), "register", changedBy, nil, &modelInfo, func(q *sqlc.Queries) error {
+		_, err := q.InsertRegisteredModel(ctx, sqlc.InsertRegisteredModelParams{
+			Name:      modelInfo.Name.String(),
+			Model:     modelInfo.Model.String(),
+			ApiUrl:    modelInfo.APIURL.String(),
+			Provider:  modelInfo.Provider.String(),
+			Status:    modelInfo.Status.String(),
+			Targets:   targets,
+			Fallbacks: fallbacks,
+			CreatedAt: pgtype.Timestamptz{Time: modelInfo.CreatedAt, Valid: true},
+		})
+		return err
+	})
+
+	// Another instance may have registered it before our cache caught up
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%w: %s", ErrModelExists, modelInfo.Name.String())
 	}
+	if err != nil {
+		return fmt.Errorf("failed to save model: %w", err)
+	}
+
+	r.Mu.Lock()
 	r.Models[modelInfo.Name.String()] = modelInfo
+	r.Mu.Unlock()
+
+	return nil
+}
+
+// Update replaces a registered model, keeping its name and registration time
+func (r *Registry) Update(ctx context.Context, modelInfo user.Model, changedBy string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	name := modelInfo.Name.String()
+	before, exists := r.GetInfo(name)
+	if !exists {
+		return ErrModelNotFound
+	}
+	modelInfo.CreatedAt = before.CreatedAt
+
+	targets, err := targetsJSON(modelInfo.Targets)
+	if err != nil {
+		return err
+	}
+
+	fallbacks, err := targetsJSON(modelInfo.Fallbacks)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, name, "update", changedBy, &before, &modelInfo, func(q *sqlc.Queries) error {
+		_, err := q.UpdateRegisteredModel(ctx, sqlc.UpdateRegisteredModelParams{
+			Name:      name,
+			Model:     modelInfo.Model.String(),
+			ApiUrl:    modelInfo.APIURL.String(),
+			Provider:  modelInfo.Provider.String(),
+			Status:    modelInfo.Status.String(),
+			Targets:   targets,
+			Fallbacks: fallbacks,
+		})
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrModelNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update model: %w", err)
+	}
+
+	r.Mu.Lock()
+	r.Models[name] = modelInfo
+	r.Mu.Unlock()
 
 	return nil
 }
 
+// Delete removes a registered model
+func (r *Registry) Delete(ctx context.Context, name string, changedBy string) error {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	before, exists := r.GetInfo(name)
+	if !exists {
+		return ErrModelNotFound
+	}
+
+	err := r.write(ctx, name, "delete", changedBy, &before, nil, func(q *sqlc.Queries) error {
+		_, err := q.DeleteRegisteredModel(ctx, name)
+		return err
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to delete model: %w", err)
+	}
+
+	r.Mu.Lock()
+	delete(r.Models, name)
+	r.Mu.Unlock()
+
+	return nil
+}
+
+// History returns the audited changes to a registered model, oldest first
+func (r *Registry) History(ctx context.Context, name string) ([]Change, error) {
+	if r.db == nil {
+		return []Change{}, nil
+	}
+
+	r.db.Mu.Lock()
+	rows, err := r.db.Queries.ListRegisteredModelChanges(ctx, name)
+	r.db.Mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0, len(rows))
+	for _, row := range rows {
+		change := Change{
+			Name:      row.Name,
+			Action:    row.Action,
+			ChangedBy: row.ChangedBy,
+			ChangedAt: row.ChangedAt.Time,
+		}
+		json.Unmarshal(row.Before, &change.Before) // Empty for registrations
+		json.Unmarshal(row.After, &change.After)   // Empty for deletions
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
 // GetModelInfo retrieves model information by custom name
 func (r *Registry) GetInfo(name string) (user.Model, bool) {
 	r.Mu.RLock()
@@ -40,3 +217,63 @@ func (r *Registry) GetInfo(name string) (user.Model, bool) {
 	info, exists := r.Models[name]
 	return info, exists
 }
+
+// write runs a change and records who made it in one transaction. It is a
+// no-op for in-memory registries.
+func (r *Registry) write(ctx context.Context, name, action, changedBy string, before, after *user.Model, change func(*sqlc.Queries) error) error {
+	if r.db == nil {
+		return nil
+	}
+
+	r.db.Mu.Lock()
+	defer r.db.Mu.Unlock()
+
+	tx, err := r.db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := r.db.Queries.WithTx(tx)
+
+	if err := change(q); err != nil {
+		return err
+	}
+
+	beforeBytes, err := modelJSON(before)
+	if err != nil {
+		return err
+	}
+	afterBytes, err := modelJSON(after)
+	if err != nil {
+		return err
+	}
+
+	err = q.InsertRegisteredModelChange(ctx, sqlc.InsertRegisteredModelChangeParams{
+		Name:      name,
+		Action:    action,
+		ChangedBy: changedBy,
+		Before:    beforeBytes,
+		After:     afterBytes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record model change: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func modelJSON(m *user.Model) ([]byte, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"name":      m.Name.String(),
+		"model":     m.Model.String(),
+		"api_url":   m.APIURL.String(),
+		"provider":  m.Provider.String(),
+		"status":    m.Status.String(),
+		"targets":   TargetsToMaps(m.Targets),
+		"fallbacks": TargetsToMaps(m.Fallbacks),
+	})
+}
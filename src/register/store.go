@@ -0,0 +1,245 @@
+package register
+
+import (
+	"context"
+	"covalence/src/db/postgres/sqlc"
+	"covalence/src/types"
+	"covalence/src/user"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// notifyChannel is the channel the registered_models trigger notifies on
+const notifyChannel = "registered_models"
+
+// Refresh replaces the cache with the registered_models table
+func (r *Registry) Refresh(ctx context.Context) error {
+	if r.db == nil {
+		return nil
+	}
+
+	r.db.Mu.Lock()
+	rows, err := r.db.Queries.ListRegisteredModels(ctx)
+	r.db.Mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to list registered models: %w", err)
+	}
+
+	models := make(map[string]user.Model, len(rows))
+	for _, row := range rows {
+		model, err := modelFromRow(row)
+		if err != nil {
+			log.Printf("skipping invalid registered model %s: %v", row.Name, err)
+			continue
+		}
+		models[row.Name] = model
+	}
+
+	r.Mu.Lock()
+	r.Models = models
+	r.Mu.Unlock()
+
+	return nil
+}
+
+// refreshOne reloads a single alias, dropping it from the cache if it no longer exists
+func (r *Registry) refreshOne(ctx context.Context, name string) error {
+	r.db.Mu.Lock()
+	row, err := r.db.Queries.GetRegisteredModel(ctx, name)
+	r.db.Mu.Unlock()
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.Mu.Lock()
+		delete(r.Models, name)
+		r.Mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	model, err := modelFromRow(row)
+	if err != nil {
+		return err
+	}
+
+	r.Mu.Lock()
+	r.Models[name] = model
+	r.Mu.Unlock()
+
+	return nil
+}
+
+// Listen keeps the cache in sync with changes made by other instances until the
+// context is cancelled. It reconnects and does a full refresh after any error,
+// since notifications sent while disconnected are lost.
+func (r *Registry) Listen(ctx context.Context) {
+	if r.db == nil {
+		return
+	}
+
+	go func() {
+		for {
+			err := r.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("registry listener stopped, reconnecting: %v", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("registry refresh failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (r *Registry) listen(ctx context.Context) error {
+	conn, err := r.db.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := r.refreshOne(ctx, notification.Payload); err != nil {
+			log.Printf("failed to refresh registered model %s: %v", notification.Payload, err)
+		}
+	}
+}
+
+func modelFromRow(row sqlc.RegisteredModel) (user.Model, error) {
+	name, err := types.NewName(row.Name)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	modelID, err := types.NewModelID(row.Model)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	apiURL, err := url.Parse(row.ApiUrl)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	provider, err := types.NewModelProvider(row.Provider)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	status, err := types.NewStatus(row.Status)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	targets, err := parseTargetsJSON(row.Targets)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	fallbacks, err := parseTargetsJSON(row.Fallbacks)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	return user.Model{
+		Name:      name,
+		Model:     modelID,
+		APIURL:    apiURL,
+		CreatedAt: row.CreatedAt.Time,
+		Status:    status,
+		Provider:  provider,
+		Targets:   targets,
+		Fallbacks: fallbacks,
+	}, nil
+}
+
+type rawTarget struct {
+	Model    string `json:"model"`
+	APIURL   string `json:"api_url"`
+	Provider string `json:"provider"`
+	Weight   int    `json:"weight"`
+}
+
+// TargetsToMaps renders a target pool for API responses and change history
+func TargetsToMaps(targets []user.Target) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, map[string]interface{}{
+			"model":    t.Model.String(),
+			"api_url":  t.APIURL.String(),
+			"provider": t.Provider.String(),
+			"weight":   t.Weight,
+		})
+	}
+	return out
+}
+
+func targetsJSON(targets []user.Target) ([]byte, error) {
+	raw := make([]rawTarget, 0, len(targets))
+	for _, t := range targets {
+		raw = append(raw, rawTarget{
+			Model:    t.Model.String(),
+			APIURL:   t.APIURL.String(),
+			Provider: t.Provider.String(),
+			Weight:   t.Weight,
+		})
+	}
+	return json.Marshal(raw)
+}
+
+func parseTargetsJSON(data []byte) ([]user.Target, error) {
+	var raw []rawTarget
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid targets: %w", err)
+	}
+
+	var targets []user.Target
+	for _, rt := range raw {
+		modelID, err := types.NewModelID(rt.Model)
+		if err != nil {
+			return nil, err
+		}
+
+		apiURL, err := url.Parse(rt.APIURL)
+		if err != nil {
+			return nil, err
+		}
+
+		provider, err := types.NewModelProvider(rt.Provider)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, user.Target{
+			Model:    modelID,
+			APIURL:   apiURL,
+			Provider: provider,
+			Weight:   rt.Weight,
+		})
+	}
+
+	return targets, nil
+}
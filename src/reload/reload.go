@@ -0,0 +1,273 @@
+package reload
+
+import (
+	"context"
+	"covalence/src/cache"
+	"covalence/src/db/postgres"
+	"covalence/src/firewall"
+	"covalence/src/internal"
+	"covalence/src/ratelimit"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/retry"
+	"covalence/src/usage"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Snapshot is one consistent view of the file-backed configuration
+type Snapshot struct {
+	Models     []internal.Model
+	Providers  *[]register.ModelProvider
+	Policies   firewall.Policies
+	Retry      retry.Policy
+	RateLimits ratelimit.Config
+	Budgets    []usage.Budget
+	Overflow   request.ContextOverflow
+	Cache      cache.Config
+	Moderation firewall.ModerationConfig // Fold /v1/moderations results into the firewall verdicts
+	LoadedAt   time.Time
+}
+
+// Loader owns the current snapshot and swaps it when the files change
+type Loader struct {
+	ConfigPath    string
+	ModelsPath    string
+	ProvidersPath string
+	DB            *postgres.DB // Optional source of policies saved through the API
+
+	current atomic.Pointer[Snapshot]
+	mu      sync.Mutex // serialises reloads
+	modTime map[string]time.Time
+}
+
+// NewLoader reads all files once and fails if any of them is invalid
+func NewLoader(configPath, modelsPath, providersPath string, db *postgres.DB) (*Loader, error) {
+	l := &Loader{
+		ConfigPath:    configPath,
+		ModelsPath:    modelsPath,
+		ProvidersPath: providersPath,
+		DB:            db,
+		modTime:       make(map[string]time.Time),
+	}
+
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Current returns the snapshot new requests should use
+func (l *Loader) Current() *Snapshot {
+	return l.current.Load()
+}
+
+// Reload reads and validates every file, then swaps the snapshot in one step.
+// On any error the previous snapshot is kept.
+func (l *Loader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	modTimes := l.readModTimes()
+
+	models, err := internal.ReadModels(l.ModelsPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ModelsPath, err)
+	}
+
+	providers, err := register.LoadModelProviders(l.ProvidersPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ProvidersPath, err)
+	}
+
+	policies, err := firewall.ReadPolicies(l.ConfigPath, models)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	retryPolicy, err := retry.ReadPolicy(l.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	rateLimits, err := ratelimit.ReadConfig(l.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	budgets, err := usage.ReadBudgets(l.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	overflow, err := request.ReadContextOverflow(l.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	cacheConfig, err := cache.ReadConfig(l.ConfigPath, models)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	moderation, err := firewall.ReadModerationConfig(l.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", l.ConfigPath, err)
+	}
+
+	if l.DB != nil {
+		err = firewall.LoadStoredPolicies(context.Background(), l.DB, &policies, models)
+		if err != nil {
+			return fmt.Errorf("invalid stored firewall config: %w", err)
+		}
+	}
+
+	internal.SetModels(models)
+	l.current.Store(&Snapshot{
+		Models:     models,
+		Providers:  providers,
+		Policies:   policies,
+		Retry:      retryPolicy,
+		RateLimits: rateLimits,
+		Budgets:    budgets,
+		Overflow:   overflow,
+		Cache:      cacheConfig,
+		Moderation: moderation,
+		LoadedAt:   time.Now(),
+	})
+	l.modTime = modTimes
+
+	log.Printf("configuration loaded: %d firewall policies, %d internal models, %d providers", len(policies.Named)+1, len(models), len(*providers))
+	return nil
+}
+
+// WatchSignals reloads on SIGHUP until the context is cancelled
+func (l *Loader) WatchSignals(ctx context.Context) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				log.Println("SIGHUP received, reloading configuration")
+				if err := l.Reload(); err != nil {
+					log.Printf("configuration reload failed, keeping previous config: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// WatchStoredFirewalls reloads whenever any instance saves a change to the
+// policies and firewalls stored in Postgres, until the context is cancelled
+func (l *Loader) WatchStoredFirewalls(ctx context.Context) {
+	if l.DB == nil {
+		return
+	}
+
+	go func() {
+		for {
+			err := l.listen(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("firewall config listener stopped, reconnecting: %v", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+
+			// Pick up changes made while not listening
+			if err := l.Reload(); err != nil {
+				log.Printf("configuration reload failed, keeping previous config: %v", err)
+			}
+		}
+	}()
+}
+
+func (l *Loader) listen(ctx context.Context) error {
+	conn, err := l.DB.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+firewall.NotifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("stored firewall config changed (%s), reloading", notification.Payload)
+		if err := l.Reload(); err != nil {
+			log.Printf("configuration reload failed, keeping previous config: %v", err)
+		}
+	}
+}
+
+// WatchFiles polls the files and reloads when any of them changes
+func (l *Loader) WatchFiles(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !l.changed() {
+					continue
+				}
+				log.Println("configuration files changed, reloading")
+				if err := l.Reload(); err != nil {
+					log.Printf("configuration reload failed, keeping previous config: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (l *Loader) changed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	changed := false
+	for path, modTime := range l.readModTimes() {
+		if !modTime.Equal(l.modTime[path]) {
+			// Remember it so an invalid file isn't retried on every tick
+			l.modTime[path] = modTime
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (l *Loader) readModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range []string{l.ConfigPath, l.ModelsPath, l.ProvidersPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		modTimes[path] = info.ModTime()
+	}
+	return modTimes
+}
@@ -0,0 +1,93 @@
+package request
+
+import (
+	"covalence/src/register"
+	"covalence/src/types"
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMaxOutputTokens caps max_tokens for models without a configured limit
+const DefaultMaxOutputTokens = 32000
+
+var ErrContextExceeded = errors.New("context window exceeded")
+
+// ContextOverflow is what to do when max_tokens doesn't fit the model
+type ContextOverflow string
+
+const (
+	OverflowReject ContextOverflow = "reject" // Reject the request
+	OverflowClamp  ContextOverflow = "clamp"  // Lower max_tokens to what fits
+)
+
+type rawContextConfig struct {
+	ContextWindow struct {
+		Overflow string `yaml:"overflow"`
+	} `yaml:"context_window"`
+}
+
+// ReadContextOverflow reads context_window.overflow from a config file, defaulting to reject
+func ReadContextOverflow(path string) (ContextOverflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var raw rawContextConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return "", err
+	}
+
+	switch overflow := ContextOverflow(raw.ContextWindow.Overflow); overflow {
+	case "":
+		return OverflowReject, nil
+	case OverflowReject, OverflowClamp:
+		return overflow, nil
+	default:
+		return "", fmt.Errorf("invalid context_window overflow %q (must be reject or clamp)", overflow)
+	}
+}
+
+// FitContext checks max_tokens and the estimated prompt against the target
+// model's limits, lowering max_tokens instead of failing when clamping. A
+// prompt that alone fills the window is always rejected.
+func (m *Generate) FitContext(limits register.Limits, overflow ContextOverflow) error {
+	model := m.Target.Model.String()
+
+	maxOutput := limits.MaxOutputTokens
+	if maxOutput == 0 {
+		maxOutput = DefaultMaxOutputTokens
+	}
+
+	if m.MaxTokens != nil && m.MaxTokens.Int() > maxOutput {
+		if overflow != OverflowClamp {
+			return fmt.Errorf("%w: max_tokens %d is more than the %d output tokens %s allows", ErrContextExceeded, m.MaxTokens.Int(), maxOutput, model)
+		}
+		m.setMaxTokens(maxOutput)
+	}
+
+	if limits.ContextWindow == 0 {
+		return nil
+	}
+
+	if m.PromptTokens >= limits.ContextWindow {
+		return fmt.Errorf("%w: the prompt is about %d tokens and %s has a %d token context window", ErrContextExceeded, m.PromptTokens, model, limits.ContextWindow)
+	}
+
+	if m.MaxTokens != nil && m.PromptTokens+m.MaxTokens.Int() > limits.ContextWindow {
+		if overflow != OverflowClamp {
+			return fmt.Errorf("%w: the prompt is about %d tokens, which leaves %d of %s's %d token context window for max_tokens %d", ErrContextExceeded, m.PromptTokens, limits.ContextWindow-m.PromptTokens, model, limits.ContextWindow, m.MaxTokens.Int())
+		}
+		m.setMaxTokens(limits.ContextWindow - m.PromptTokens)
+	}
+
+	return nil
+}
+
+func (m *Generate) setMaxTokens(value int) {
+	maxTokens, _ := types.NewMaxTokens(value) // Always > 0 here
+	m.MaxTokens = &maxTokens
+}
@@ -0,0 +1,69 @@
+package request
+
+import (
+	"covalence/src/register"
+	"covalence/src/types"
+	"covalence/src/user"
+	"errors"
+	"testing"
+)
+
+func TestFitContext(t *testing.T) {
+	tests := []struct {
+		name          string
+		limits        register.Limits
+		overflow      ContextOverflow
+		promptTokens  int
+		maxTokens     int // 0 leaves max_tokens unset
+		wantErr       bool
+		wantMaxTokens int
+	}{
+		{name: "no limits", overflow: OverflowReject, promptTokens: 100},
+		{name: "fits", limits: register.Limits{ContextWindow: 1000, MaxOutputTokens: 500}, overflow: OverflowReject, promptTokens: 600, maxTokens: 300, wantMaxTokens: 300},
+		{name: "over default output cap rejected", overflow: OverflowReject, maxTokens: DefaultMaxOutputTokens + 1, wantErr: true},
+		{name: "over default output cap clamped", overflow: OverflowClamp, maxTokens: DefaultMaxOutputTokens + 1, wantMaxTokens: DefaultMaxOutputTokens},
+		{name: "over model output cap rejected", limits: register.Limits{MaxOutputTokens: 100}, overflow: OverflowReject, maxTokens: 200, wantErr: true},
+		{name: "over window rejected", limits: register.Limits{ContextWindow: 1000}, overflow: OverflowReject, promptTokens: 600, maxTokens: 500, wantErr: true},
+		{name: "over window clamped", limits: register.Limits{ContextWindow: 1000}, overflow: OverflowClamp, promptTokens: 600, maxTokens: 500, wantMaxTokens: 400},
+		{name: "clamped to output cap then window", limits: register.Limits{ContextWindow: 1000, MaxOutputTokens: 100}, overflow: OverflowClamp, promptTokens: 950, maxTokens: 200, wantMaxTokens: 50},
+		{name: "prompt fills window", limits: register.Limits{ContextWindow: 1000}, overflow: OverflowClamp, promptTokens: 1000, wantErr: true},
+		{name: "prompt fits without max_tokens", limits: register.Limits{ContextWindow: 1000}, overflow: OverflowReject, promptTokens: 999},
+	}
+
+	model, err := types.NewModelID("gpt-4o")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Generate{Target: user.Target{Model: model}, PromptTokens: tt.promptTokens}
+			if tt.maxTokens > 0 {
+				maxTokens, err := types.NewMaxTokens(tt.maxTokens)
+				if err != nil {
+					t.Fatal(err)
+				}
+				g.MaxTokens = &maxTokens
+			}
+
+			err := g.FitContext(tt.limits, tt.overflow)
+			if tt.wantErr {
+				if !errors.Is(err, ErrContextExceeded) {
+					t.Fatalf("FitContext() error = %v, want ErrContextExceeded", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FitContext() error = %v", err)
+			}
+
+			got := 0
+			if g.MaxTokens != nil {
+				got = g.MaxTokens.Int()
+			}
+			if got != tt.wantMaxTokens {
+				t.Errorf("max_tokens = %d, want %d", got, tt.wantMaxTokens)
+			}
+		})
+	}
+}
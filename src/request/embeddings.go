@@ -0,0 +1,179 @@
+package request
+
+import (
+	"covalence/src/audit"
+	"covalence/src/register"
+	"covalence/src/tokenizer"
+	"covalence/src/types"
+	"covalence/src/user"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rawEmbeddings struct {
+	Name           string      `json:"model" binding:"required"`
+	Input          interface{} `json:"input" binding:"required"`
+	EncodingFormat string      `json:"encoding_format"`
+	Dimensions     *int        `json:"dimensions"`
+}
+
+// Embeddings stores information about an embeddings request
+type Embeddings struct {
+	User           user.User
+	Model          user.Model
+	Target         user.Target
+	TargetURL      url.URL
+	Path           string
+	Inputs         []string
+	Batch          bool // Input was sent as an array, so the response has one embedding per entry
+	EncodingFormat string
+	Dimensions     *int
+	PromptTokens   int // Local estimate of the inputs' tokens
+	ClientIP       string
+}
+
+func ParseEmbeddings(c *gin.Context, registry *register.Registry) (Embeddings, error) {
+
+	var re rawEmbeddings
+	if err := c.ShouldBindJSON(&re); err != nil {
+		return Embeddings{}, err
+	}
+
+	user, err := ParseUser(c)
+	if err != nil {
+		return Embeddings{}, err
+	}
+
+	modelInfo, err := lookupModel(registry, re.Name)
+	if err != nil {
+		return Embeddings{}, err
+	}
+
+	inputs, batch, err := parseInputs(re.Input)
+	if err != nil {
+		return Embeddings{}, fmt.Errorf("invalid input: %w", err)
+	}
+
+	if re.Dimensions != nil && *re.Dimensions <= 0 {
+		return Embeddings{}, errors.New("dimensions must be greater than 0")
+	}
+
+	if re.EncodingFormat != "" && re.EncodingFormat != "float" && re.EncodingFormat != "base64" {
+		return Embeddings{}, errors.New("encoding_format must be float or base64")
+	}
+
+	promptTokens := 0
+	for _, input := range inputs {
+		promptTokens += tokenizer.Count(input)
+	}
+
+	return Embeddings{
+		Model:          modelInfo,
+		Path:           c.Param("path"),
+		Inputs:         inputs,
+		Batch:          batch,
+		EncodingFormat: re.EncodingFormat,
+		Dimensions:     re.Dimensions,
+		PromptTokens:   promptTokens,
+		ClientIP:       c.RemoteIP(),
+		User:           user,
+	}.WithTarget(modelInfo.PickTarget()), nil
+}
+
+// parseInputs accepts a string or an array of strings, returning whether it
+// was an array. Token arrays are rejected, as the firewalls can't read them.
+func parseInputs(input interface{}) ([]string, bool, error) {
+	switch v := input.(type) {
+	case string:
+		if v == "" {
+			return nil, false, errors.New("cannot be empty")
+		}
+		return []string{v}, false, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, false, errors.New("must be a non-empty array")
+		}
+		inputs := make([]string, 0, len(v))
+		for _, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false, errors.New("must be a string or an array of strings")
+			}
+			if text == "" {
+				return nil, false, errors.New("cannot contain empty strings")
+			}
+			inputs = append(inputs, text)
+		}
+		return inputs, true, nil
+	default:
+		return nil, false, errors.New("must be a string or an array of strings")
+	}
+}
+
+// WithTarget points the request at another backend, e.g. a fallback
+func (m Embeddings) WithTarget(target user.Target) Embeddings {
+	m.Target = target
+	m.TargetURL = targetURL(target, m.Path)
+	return m
+}
+
+// Messages presents each input as a user message, for the firewalls
+func (m Embeddings) Messages() []types.Message {
+	messages := make([]types.Message, len(m.Inputs))
+	for i, input := range m.Inputs {
+		messages[i] = types.Message{Role: "user", Content: input}
+	}
+	return messages
+}
+
+func (m Embeddings) ToMap() map[string]interface{} {
+	requestMap := map[string]interface{}{
+		"model": m.Target.Model.String(),
+	}
+
+	// Send the input in the shape the client used, so the response matches
+	if m.Batch {
+		requestMap["input"] = m.Inputs
+	} else {
+		requestMap["input"] = m.Inputs[0]
+	}
+
+	if m.EncodingFormat != "" {
+		requestMap["encoding_format"] = m.EncodingFormat
+	}
+	if m.Dimensions != nil {
+		requestMap["dimensions"] = *m.Dimensions
+	}
+
+	return requestMap
+}
+
+func (m Embeddings) ToAuditRequest() audit.Request {
+
+	parameters := map[string]interface{}{
+		"encoding_format": m.EncodingFormat,
+		"dimensions":      m.Dimensions,
+	}
+
+	var inputs []map[string]interface{}
+	for _, message := range m.Messages() {
+		inputs = append(inputs, map[string]interface{}{
+			"role":    message.Role,
+			"content": message.Content,
+		})
+	}
+
+	return audit.Request{
+		UserID:     m.User.ID.String(),
+		APIKeyID:   m.User.APIKeyID.String(),
+		Model:      m.Target.Model.String(),
+		Alias:      m.Model.Name.String(),
+		TargetURL:  m.TargetURL.String(),
+		Inputs:     inputs,
+		Parameters: parameters,
+		ClientIP:   m.ClientIP,
+	}
+}
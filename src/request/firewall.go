@@ -0,0 +1,140 @@
+package request
+
+import (
+	"covalence/src/internal"
+	"covalence/src/types"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type rawPolicy struct {
+	Name    string   `json:"name"`
+	APIKeys []string `json:"api_keys"`
+	Users   []string `json:"users"`
+	Models  []string `json:"models"`
+}
+
+// Policy is a named firewall policy and who it is bound to
+type Policy struct {
+	Name    types.Name
+	APIKeys []uuid.UUID
+	Users   []uuid.UUID
+	Models  []types.Name
+}
+
+type rawFirewall struct {
+	Policy            string   `json:"policy" binding:"required"`
+	Enabled           *bool    `json:"enabled"`
+	Type              string   `json:"type" binding:"required"`
+	Mode              *string  `json:"mode"`
+	Model             string   `json:"model" binding:"required"`
+	BlockingThreshold *float32 `json:"blocking_threshold" binding:"required"`
+}
+
+// Firewall is a firewall definition sent to the config API
+type Firewall struct {
+	Policy            types.Name
+	Enabled           bool
+	Type              types.FirewallType
+	Mode              types.FirewallMode
+	Model             types.ModelID
+	BlockingThreshold float32
+}
+
+// ParsePolicy reads a policy from the body; the name in the path wins over the body
+func ParsePolicy(c *gin.Context) (Policy, error) {
+	var r rawPolicy
+	if err := c.ShouldBindJSON(&r); err != nil {
+		return Policy{}, err
+	}
+
+	if c.Param("name") != "" {
+		r.Name = c.Param("name")
+	}
+
+	name, err := types.NewName(r.Name)
+	if err != nil {
+		return Policy{}, errors.New("invalid policy name")
+	}
+
+	policy := Policy{Name: name}
+
+	for _, key := range r.APIKeys {
+		id, err := uuid.Parse(key)
+		if err != nil {
+			return Policy{}, errors.New("invalid api key id")
+		}
+		policy.APIKeys = append(policy.APIKeys, id)
+	}
+
+	for _, u := range r.Users {
+		id, err := uuid.Parse(u)
+		if err != nil {
+			return Policy{}, errors.New("invalid user id")
+		}
+		policy.Users = append(policy.Users, id)
+	}
+
+	for _, m := range r.Models {
+		model, err := types.NewName(m)
+		if err != nil {
+			return Policy{}, errors.New("invalid model name")
+		}
+		policy.Models = append(policy.Models, model)
+	}
+
+	return policy, nil
+}
+
+func ParseFirewall(c *gin.Context) (Firewall, error) {
+	var r rawFirewall
+	if err := c.ShouldBindJSON(&r); err != nil {
+		return Firewall{}, err
+	}
+
+	policy, err := types.NewName(r.Policy)
+	if err != nil {
+		return Firewall{}, errors.New("invalid policy name")
+	}
+
+	firewallType, err := types.NewFirewallType(r.Type)
+	if err != nil {
+		return Firewall{}, err
+	}
+
+	mode := types.Enforce()
+	if r.Mode != nil {
+		mode, err = types.NewFirewallMode(*r.Mode)
+		if err != nil {
+			return Firewall{}, err
+		}
+	}
+
+	model, err := types.NewModelID(r.Model)
+	if err != nil {
+		return Firewall{}, errors.New("invalid model")
+	}
+	if !internal.CheckModelExists(model) {
+		return Firewall{}, errors.New("model is not a loaded internal model")
+	}
+
+	if *r.BlockingThreshold < 0 || *r.BlockingThreshold > 1 {
+		return Firewall{}, errors.New("invalid blocking_threshold value (must be between 0 and 1)")
+	}
+
+	enabled := true
+	if r.Enabled != nil {
+		enabled = *r.Enabled
+	}
+
+	return Firewall{
+		Policy:            policy,
+		Enabled:           enabled,
+		Type:              firewallType,
+		Mode:              mode,
+		Model:             model,
+		BlockingThreshold: *r.BlockingThreshold,
+	}, nil
+}
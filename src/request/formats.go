@@ -0,0 +1,210 @@
+package request
+
+import (
+	"covalence/src/register"
+	"covalence/src/tokenizer"
+	"covalence/src/types"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Format is the OpenAI API a generation request is made in
+type Format string
+
+const (
+	FormatChat        Format = "chat"        // /chat/completions, with messages
+	FormatCompletions Format = "completions" // Legacy /completions, with a prompt
+	FormatResponses   Format = "responses"   // /responses, with input and instructions
+)
+
+type rawCompletion struct {
+	Name        string      `json:"model" binding:"required"`
+	Prompt      interface{} `json:"prompt" binding:"required"`
+	IsStreaming bool        `json:"stream"`
+	MaxTokens   *int        `json:"max_tokens"`
+	Temperature *float32    `json:"temperature"`
+}
+
+type rawResponse struct {
+	Name            string      `json:"model" binding:"required"`
+	Input           interface{} `json:"input" binding:"required"`
+	Instructions    string      `json:"instructions"`
+	IsStreaming     bool        `json:"stream"`
+	MaxOutputTokens *int        `json:"max_output_tokens"`
+	Temperature     *float32    `json:"temperature"`
+}
+
+// ParseCompletion reads a legacy completions request. Each prompt becomes a
+// user message, so firewalls and audits treat it like a chat request.
+func ParseCompletion(c *gin.Context, registry *register.Registry) (Generate, error) {
+
+	var rc rawCompletion
+	if err := c.ShouldBindJSON(&rc); err != nil {
+		return Generate{}, err
+	}
+
+	user, err := ParseUser(c)
+	if err != nil {
+		return Generate{}, err
+	}
+
+	modelInfo, err := lookupModel(registry, rc.Name)
+	if err != nil {
+		return Generate{}, err
+	}
+
+	prompts, batch, err := parseInputs(rc.Prompt)
+	if err != nil {
+		return Generate{}, fmt.Errorf("invalid prompt: %w", err)
+	}
+
+	messages := make([]types.Message, len(prompts))
+	for i, prompt := range prompts {
+		messages[i] = types.Message{Role: "user", Content: prompt}
+	}
+
+	payload := Generate{
+		Model:        modelInfo,
+		Path:         c.Param("path"),
+		Format:       FormatCompletions,
+		StringInput:  !batch,
+		IsStreaming:  rc.IsStreaming,
+		ClientIP:     c.RemoteIP(),
+		Messages:     messages,
+		PromptTokens: tokenizer.CountMessages(messages),
+		User:         user,
+	}.WithTarget(modelInfo.PickTarget())
+
+	return payload.withOptional(rc.MaxTokens, rc.Temperature)
+}
+
+// ParseResponse reads a Responses API request. The input is a string or an
+// array of user and assistant messages; other input items aren't supported.
+func ParseResponse(c *gin.Context, registry *register.Registry) (Generate, error) {
+
+	var rr rawResponse
+	if err := c.ShouldBindJSON(&rr); err != nil {
+		return Generate{}, err
+	}
+
+	user, err := ParseUser(c)
+	if err != nil {
+		return Generate{}, err
+	}
+
+	modelInfo, err := lookupModel(registry, rr.Name)
+	if err != nil {
+		return Generate{}, err
+	}
+
+	messages, stringInput, err := parseResponseInput(rr.Input)
+	if err != nil {
+		return Generate{}, fmt.Errorf("invalid input: %w", err)
+	}
+
+	payload := Generate{
+		Model:        modelInfo,
+		Path:         c.Param("path"),
+		Format:       FormatResponses,
+		Instructions: rr.Instructions,
+		StringInput:  stringInput,
+		IsStreaming:  rr.IsStreaming,
+		ClientIP:     c.RemoteIP(),
+		Messages:     messages,
+		PromptTokens: tokenizer.CountMessages(messages) + tokenizer.Count(rr.Instructions),
+		User:         user,
+	}.WithTarget(modelInfo.PickTarget())
+
+	return payload.withOptional(rr.MaxOutputTokens, rr.Temperature)
+}
+
+func parseResponseInput(input interface{}) ([]types.Message, bool, error) {
+	if text, ok := input.(string); ok {
+		message, err := types.NewMessage("user", text)
+		if err != nil {
+			return nil, false, err
+		}
+		return []types.Message{message}, true, nil
+	}
+
+	items, ok := input.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, false, errors.New("input must be a string or a non-empty array of messages")
+	}
+
+	messages := make([]types.Message, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false, errors.New("input items must be messages")
+		}
+		if itemType, _ := fields["type"].(string); itemType != "" && itemType != "message" {
+			return nil, false, fmt.Errorf("input items of type %s are not supported", itemType)
+		}
+
+		role, _ := fields["role"].(string)
+		content, err := responseContent(fields["content"])
+		if err != nil {
+			return nil, false, err
+		}
+
+		message, err := types.NewMessage(role, content)
+		if err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, false, nil
+}
+
+// responseContent reads a message's content, joining text parts
+func responseContent(content interface{}) (string, error) {
+	switch v := content.(type) {
+	case string:
+		return v, nil
+	case []interface{}:
+		var texts []string
+		for _, part := range v {
+			fields, _ := part.(map[string]interface{})
+			partType, _ := fields["type"].(string)
+			if partType != "input_text" && partType != "output_text" {
+				return "", fmt.Errorf("content parts of type %q are not supported", partType)
+			}
+			text, _ := fields["text"].(string)
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, "\n"), nil
+	default:
+		return "", errors.New("content must be a string or an array of text parts")
+	}
+}
+
+// prompt rebuilds a completions prompt in the shape the client sent it
+func (m Generate) prompt() interface{} {
+	if m.StringInput {
+		return m.Messages[0].Content
+	}
+
+	prompts := make([]string, len(m.Messages))
+	for i, msg := range m.Messages {
+		prompts[i] = msg.Content
+	}
+	return prompts
+}
+
+// input rebuilds a Responses API input in the shape the client sent it
+func (m Generate) input() interface{} {
+	if m.StringInput {
+		return m.Messages[0].Content
+	}
+
+	items := make([]map[string]string, len(m.Messages))
+	for i, msg := range m.Messages {
+		items[i] = msg.ToMap()
+	}
+	return items
+}
@@ -3,9 +3,11 @@ package request
 import (
 	"covalence/src/audit"
 	"covalence/src/register"
+	"covalence/src/tokenizer"
 	"covalence/src/types"
 	"covalence/src/user"
 	"errors"
+	"fmt"
 	"log"
 	"net/url"
 	"path"
@@ -14,6 +16,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	ErrModelInactive = errors.New("model is inactive")
+	ErrModelNotFound = errors.New("model not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+)
+
 // GenerateRequest represents the incoming JSON request
 type rawGenerate struct {
 	Name        string        `json:"model" binding:"required"`
@@ -25,14 +33,21 @@ type rawGenerate struct {
 
 // GeneratePayload stores information about a generation request
 type Generate struct {
-	User        user.User
-	Model       user.Model
-	TargetURL   url.URL
-	IsStreaming bool
-	MaxTokens   *types.MaxTokens   // Now a pointer to make it optional
-	Temperature *types.Temperature // Now a pointer to make it optional
-	Messages    []types.Message
-	ClientIP    string
+	User         user.User
+	Model        user.Model
+	Target       user.Target // Backend chosen from the alias's pool
+	TargetURL    url.URL
+	Path         string // Path requested by the client, relative to the target's api_url
+	Format       Format // API the request was made to, and is sent upstream in
+	Instructions string // Responses API system instructions
+	StringInput  bool   // Prompt or input was sent as a plain string rather than an array
+	IsStreaming  bool
+	MaxTokens    *types.MaxTokens   // Now a pointer to make it optional
+	PromptTokens int                // Local estimate of the prompt's tokens
+	Temperature  *types.Temperature // Now a pointer to make it optional
+	Messages     []types.Message
+	ClientIP     string
+	Rules        register.ParameterRules // How the target model takes the optional parameters
 }
 
 func ParseGenerate(c *gin.Context, registry *register.Registry) (Generate, error) {
@@ -42,48 +57,21 @@ func ParseGenerate(c *gin.Context, registry *register.Registry) (Generate, error
 		return Generate{}, err
 	}
 
-	// Read API key from Authorization header
-	authHeader := c.GetHeader("Authorization")
-	// Expecting format: "Bearer <apikey>"
-	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-		return Generate{}, errors.New("missing or invalid Authorization header")
-	}
-	apiKey := strings.TrimPrefix(authHeader, "Bearer ")
-	apiKey = strings.TrimSpace(apiKey)
-
-	// Look up user by API key
-	user, err := user.GetUserByAPIKey(apiKey)
+	user, err := ParseUser(c)
 	if err != nil {
-		return Generate{}, errors.New("Invalid API key")
+		return Generate{}, err
 	}
 
-	// Look for model in the parsed data
-	name, err := types.NewName(rg.Name)
+	modelInfo, err := lookupModel(registry, rg.Name)
 	if err != nil {
 		return Generate{}, err
 	}
 
-	// Look up model info
-	modelInfo, exists := registry.GetInfo(name.String())
-	if !exists {
-		return Generate{}, errors.New("model not found")
-	}
-
 	// Get the client IP address
 	clientIP := c.RemoteIP()
 
-	// Build target URL
-	baseURL := modelInfo.APIURL // assuming this is a *url.URL
-	pathToAdd := c.Param("path")
-
-	// Clone the URL to avoid mutating the original
-	targetURL := *baseURL
-	targetURL.Path = path.Join(targetURL.Path, pathToAdd)
-
-	log.Printf("target URL raw: %s", targetURL.String())
-	if err != nil {
-		return Generate{}, err
-	}
+	// Pick a backend from the alias's weighted pool
+	target := modelInfo.PickTarget()
 
 	// Build messages array
 	if len(rg.Messages) == 0 {
@@ -102,68 +90,218 @@ func ParseGenerate(c *gin.Context, registry *register.Registry) (Generate, error
 
 	// Initialize the payload with required fields
 	payload := Generate{
-		Model:       modelInfo,
-		IsStreaming: rg.IsStreaming,
-		TargetURL:   targetURL,
-		ClientIP:    clientIP,
-		Messages:    messagesArray,
-		User:        user,
-	}
+		Model:        modelInfo,
+		Path:         c.Param("path"),
+		Format:       FormatChat,
+		IsStreaming:  rg.IsStreaming,
+		ClientIP:     clientIP,
+		Messages:     messagesArray,
+		PromptTokens: tokenizer.CountMessages(messagesArray),
+		User:         user,
+	}.WithTarget(target)
+
+	return payload.withOptional(rg.MaxTokens, rg.Temperature)
+}
 
-	// Handle optional parameters
-	if rg.MaxTokens != nil {
-		maxTokens, err := types.NewMaxTokens(*rg.MaxTokens)
+// withOptional validates and sets the optional parameters
+func (m Generate) withOptional(maxTokens *int, temperature *float32) (Generate, error) {
+	if maxTokens != nil {
+		value, err := types.NewMaxTokens(*maxTokens)
 		if err != nil {
 			return Generate{}, err
 		}
-		payload.MaxTokens = &maxTokens
+		m.MaxTokens = &value
 	}
 
-	if rg.Temperature != nil {
-		temp, err := types.NewTemperature(*rg.Temperature)
+	if temperature != nil {
+		value, err := types.NewTemperature(*temperature)
 		if err != nil {
 			return Generate{}, err
 		}
-		payload.Temperature = &temp
+		m.Temperature = &value
+	}
+
+	return m, nil
+}
+
+// lookupModel finds an active registered model by the name the client sent
+func lookupModel(registry *register.Registry, rawName string) (user.Model, error) {
+	name, err := types.NewName(rawName)
+	if err != nil {
+		return user.Model{}, err
+	}
+
+	modelInfo, exists := registry.GetInfo(name.String())
+	if !exists {
+		return user.Model{}, fmt.Errorf("%w: %s", ErrModelNotFound, name.String())
+	}
+
+	if modelInfo.Status == types.Inactive() {
+		return user.Model{}, fmt.Errorf("%w: %s", ErrModelInactive, name.String())
+	}
+
+	return modelInfo, nil
+}
+
+// WithTarget points the request at another backend, e.g. a fallback
+func (m Generate) WithTarget(target user.Target) Generate {
+	m.Target = target
+	m.TargetURL = targetURL(target, m.Path)
+	return m
+}
+
+// targetURL joins the client's path onto a target's api_url
+func targetURL(target user.Target, clientPath string) url.URL {
+	// Clone the URL to avoid mutating the original
+	targetURL := *target.APIURL
+	targetURL.Path = path.Join(targetURL.Path, clientPath)
+
+	log.Printf("target URL raw: %s", targetURL.String())
+
+	return targetURL
+}
+
+// EstimatedTokens is the most a request can use before it is sent: the
+// prompt estimate plus max_tokens for the completion
+func (m Generate) EstimatedTokens() int64 {
+	tokens := int64(m.PromptTokens)
+	if m.MaxTokens != nil {
+		tokens += int64(m.MaxTokens.Int())
 	}
+	return tokens
+}
 
-	return payload, nil
+// ParseUser looks up the caller from the Authorization header
+func ParseUser(c *gin.Context) (user.User, error) {
+	// Read API key from Authorization header
+	authHeader := c.GetHeader("Authorization")
+	// Expecting format: "Bearer <apikey>"
+	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		return user.User{}, fmt.Errorf("%w: missing or invalid Authorization header", ErrUnauthorized)
+	}
+	apiKey := strings.TrimPrefix(authHeader, "Bearer ")
+	apiKey = strings.TrimSpace(apiKey)
+
+	// Look up user by API key
+	u, err := user.GetUserByAPIKey(apiKey)
+	if err != nil {
+		return user.User{}, fmt.Errorf("%w: invalid API key", ErrUnauthorized)
+	}
+
+	return u, nil
 }
 
 func (m Generate) ToMap() map[string]interface{} {
 	// Start with required parameters
 	requestMap := map[string]interface{}{
-		"model":    m.Model.Model.String(),
-		"messages": make([]map[string]string, len(m.Messages)),
-		"stream":   m.IsStreaming,
+		"model":  m.Target.Model.String(),
+		"stream": m.IsStreaming,
 	}
 
-	// Convert messages
-	for i, msg := range m.Messages {
-		requestMap["messages"].([]map[string]string)[i] = msg.ToMap()
+	// Convert messages into the request's format
+	switch m.Format {
+	case FormatCompletions:
+		requestMap["prompt"] = m.prompt()
+	case FormatResponses:
+		requestMap["input"] = m.input()
+		if m.Instructions != "" {
+			requestMap["instructions"] = m.Instructions
+		}
+	default:
+		messages := make([]map[string]string, len(m.Messages))
+		for i, msg := range m.Messages {
+			messages[i] = msg.ToMap()
+		}
+		requestMap["messages"] = messages
 	}
 
 	// Only add optional parameters if they were explicitly set
+	for name, value := range m.Parameters() {
+		requestMap[name] = value
+	}
+
+	return requestMap
+}
+
+// Parameters returns the optional parameters that were set, as the target
+// model takes them: stripped or renamed. CheckParameters has already checked
+// them against its ranges.
+func (m Generate) Parameters() map[string]interface{} {
+	params := map[string]interface{}{}
+
 	if m.MaxTokens != nil {
-		requestMap["max_tokens"] = m.MaxTokens.Int()
+		if _, name, send := m.rule("max_tokens"); send {
+			// The Responses API has its own name for it, whatever the model
+			if m.Format == FormatResponses {
+				name = "max_output_tokens"
+			}
+			params[name] = m.MaxTokens.Int()
+		}
 	}
 
 	if m.Temperature != nil {
-		requestMap["temperature"] = m.Temperature.Float32()
+		if _, name, send := m.rule("temperature"); send {
+			params[name] = m.Temperature.Float32()
+		}
 	}
 
-	return requestMap
+	return params
 }
 
-func (m Generate) ToAuditRequest() audit.Request {
+// DefaultMaxTemperature caps temperature for models whose rules don't set a max
+const DefaultMaxTemperature = 2.0
 
-	endpoint := "/v1/generate"
+// CheckParameters rejects values outside the target model's ranges. Parameters
+// the model doesn't take are stripped rather than rejected.
+func (m Generate) CheckParameters() error {
+	if m.MaxTokens != nil {
+		if rule, _, send := m.rule("max_tokens"); send {
+			if err := rule.Check("max_tokens", float64(m.MaxTokens.Int())); err != nil {
+				return fmt.Errorf("%w for %s", err, m.Target.Model.String())
+			}
+		}
+	}
+
+	if m.Temperature != nil {
+		if rule, _, send := m.rule("temperature"); send {
+			if rule.Max == nil {
+				max := DefaultMaxTemperature
+				rule.Max = &max
+			}
+			if err := rule.Check("temperature", float64(m.Temperature.Float32())); err != nil {
+				return fmt.Errorf("%w for %s", err, m.Target.Model.String())
+			}
+		}
+	}
+
+	return nil
+}
+
+// rule returns a parameter's rule, the name to send it under, and whether to send it at all
+func (m Generate) rule(name string) (register.ParameterRule, string, bool) {
+	rule := m.Rules[name]
+	if rule.Strip {
+		return rule, "", false
+	}
+	if rule.Rename != "" {
+		return rule, rule.Rename, true
+	}
+	return rule, name, true
+}
+
+func (m Generate) ToAuditRequest() audit.Request {
 
 	parameters := map[string]interface{}{
 		"stream":      m.IsStreaming,
 		"max_tokens":  m.MaxTokens,
 		"temperature": m.Temperature,
 	}
+	if m.Format != FormatChat {
+		parameters["format"] = m.Format
+	}
+	if m.Instructions != "" {
+		parameters["instructions"] = m.Instructions
+	}
 
 	var messages []map[string]interface{}
 	for _, message := range m.Messages {
@@ -179,8 +317,9 @@ func (m Generate) ToAuditRequest() audit.Request {
 	return audit.Request{
 		UserID:     m.User.ID.String(),
 		APIKeyID:   m.User.APIKeyID.String(),
-		Model:      m.Model.Model.String(),
-		TargetURL:  endpoint,
+		Model:      m.Target.Model.String(),
+		Alias:      m.Model.Name.String(),
+		TargetURL:  m.TargetURL.String(),
 		Inputs:     messages,
 		Parameters: parameters,
 		ClientIP:   m.ClientIP,
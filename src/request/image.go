@@ -0,0 +1,137 @@
+package request
+
+import (
+	"covalence/src/audit"
+	"covalence/src/register"
+	"covalence/src/tokenizer"
+	"covalence/src/types"
+	"covalence/src/user"
+	"errors"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rawImage struct {
+	Name           string `json:"model" binding:"required"`
+	Prompt         string `json:"prompt" binding:"required"`
+	N              *int   `json:"n"`
+	Size           string `json:"size"`
+	Quality        string `json:"quality"`
+	Style          string `json:"style"`
+	ResponseFormat string `json:"response_format"`
+}
+
+// Image stores information about an image generation request
+type Image struct {
+	User           user.User
+	Model          user.Model
+	Target         user.Target
+	TargetURL      url.URL
+	Path           string
+	Prompt         string
+	N              *int
+	Size           string
+	Quality        string
+	Style          string
+	ResponseFormat string
+	PromptTokens   int // Local estimate of the prompt's tokens
+	ClientIP       string
+}
+
+func ParseImage(c *gin.Context, registry *register.Registry) (Image, error) {
+
+	var ri rawImage
+	if err := c.ShouldBindJSON(&ri); err != nil {
+		return Image{}, err
+	}
+
+	user, err := ParseUser(c)
+	if err != nil {
+		return Image{}, err
+	}
+
+	modelInfo, err := lookupModel(registry, ri.Name)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if ri.N != nil && *ri.N <= 0 {
+		return Image{}, errors.New("n must be greater than 0")
+	}
+
+	if ri.ResponseFormat != "" && ri.ResponseFormat != "url" && ri.ResponseFormat != "b64_json" {
+		return Image{}, errors.New("response_format must be url or b64_json")
+	}
+
+	return Image{
+		Model:          modelInfo,
+		Path:           c.Param("path"),
+		Prompt:         ri.Prompt,
+		N:              ri.N,
+		Size:           ri.Size,
+		Quality:        ri.Quality,
+		Style:          ri.Style,
+		ResponseFormat: ri.ResponseFormat,
+		PromptTokens:   tokenizer.Count(ri.Prompt),
+		ClientIP:       c.RemoteIP(),
+		User:           user,
+	}.WithTarget(modelInfo.PickTarget()), nil
+}
+
+// WithTarget points the request at another backend, e.g. a fallback
+func (m Image) WithTarget(target user.Target) Image {
+	m.Target = target
+	m.TargetURL = targetURL(target, m.Path)
+	return m
+}
+
+// Messages presents the prompt as a user message, for the firewalls
+func (m Image) Messages() []types.Message {
+	return []types.Message{{Role: "user", Content: m.Prompt}}
+}
+
+// parameters returns the optional parameters that were set
+func (m Image) parameters() map[string]interface{} {
+	params := map[string]interface{}{}
+	if m.N != nil {
+		params["n"] = *m.N
+	}
+	for name, value := range map[string]string{
+		"size":            m.Size,
+		"quality":         m.Quality,
+		"style":           m.Style,
+		"response_format": m.ResponseFormat,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+func (m Image) ToMap() map[string]interface{} {
+	requestMap := map[string]interface{}{
+		"model":  m.Target.Model.String(),
+		"prompt": m.Prompt,
+	}
+
+	for name, value := range m.parameters() {
+		requestMap[name] = value
+	}
+
+	return requestMap
+}
+
+func (m Image) ToAuditRequest() audit.Request {
+	return audit.Request{
+		UserID:     m.User.ID.String(),
+		APIKeyID:   m.User.APIKeyID.String(),
+		Model:      m.Target.Model.String(),
+		Alias:      m.Model.Name.String(),
+		TargetURL:  m.TargetURL.String(),
+		Inputs:     []map[string]interface{}{{"role": "user", "content": m.Prompt}},
+		Parameters: m.parameters(),
+		ClientIP:   m.ClientIP,
+	}
+}
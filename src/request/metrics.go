@@ -17,4 +17,7 @@ type Metrics struct {
 	Name                   types.Name
 	Model                  types.ModelID
 	StreamingResponse      bool
+	Attempts               int // Upstream calls made, including retries and fallbacks
+	Retries                int // Upstream calls that repeated a failed call to the same target
+	CacheHit               bool
 }
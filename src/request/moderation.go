@@ -0,0 +1,123 @@
+package request
+
+import (
+	"covalence/src/audit"
+	"covalence/src/register"
+	"covalence/src/tokenizer"
+	"covalence/src/types"
+	"covalence/src/user"
+	"fmt"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rawModeration struct {
+	Name  string      `json:"model" binding:"required"`
+	Input interface{} `json:"input" binding:"required"`
+}
+
+// Moderation stores information about a moderation request
+type Moderation struct {
+	User         user.User
+	Model        user.Model
+	Target       user.Target
+	TargetURL    url.URL
+	Path         string
+	Inputs       []string
+	Batch        bool // Input was sent as an array, so the response has one result per entry
+	PromptTokens int  // Local estimate of the inputs' tokens
+	ClientIP     string
+}
+
+// ParseModeration reads a moderation request. Only text inputs are supported.
+func ParseModeration(c *gin.Context, registry *register.Registry) (Moderation, error) {
+
+	var rm rawModeration
+	if err := c.ShouldBindJSON(&rm); err != nil {
+		return Moderation{}, err
+	}
+
+	user, err := ParseUser(c)
+	if err != nil {
+		return Moderation{}, err
+	}
+
+	modelInfo, err := lookupModel(registry, rm.Name)
+	if err != nil {
+		return Moderation{}, err
+	}
+
+	inputs, batch, err := parseInputs(rm.Input)
+	if err != nil {
+		return Moderation{}, fmt.Errorf("invalid input: %w", err)
+	}
+
+	promptTokens := 0
+	for _, input := range inputs {
+		promptTokens += tokenizer.Count(input)
+	}
+
+	return Moderation{
+		Model:        modelInfo,
+		Path:         c.Param("path"),
+		Inputs:       inputs,
+		Batch:        batch,
+		PromptTokens: promptTokens,
+		ClientIP:     c.RemoteIP(),
+		User:         user,
+	}.WithTarget(modelInfo.PickTarget()), nil
+}
+
+// WithTarget points the request at another backend, e.g. a fallback
+func (m Moderation) WithTarget(target user.Target) Moderation {
+	m.Target = target
+	m.TargetURL = targetURL(target, m.Path)
+	return m
+}
+
+// Messages presents each input as a user message, for the firewalls
+func (m Moderation) Messages() []types.Message {
+	messages := make([]types.Message, len(m.Inputs))
+	for i, input := range m.Inputs {
+		messages[i] = types.Message{Role: "user", Content: input}
+	}
+	return messages
+}
+
+func (m Moderation) ToMap() map[string]interface{} {
+	requestMap := map[string]interface{}{
+		"model": m.Target.Model.String(),
+	}
+
+	// Send the input in the shape the client used, so the response matches
+	if m.Batch {
+		requestMap["input"] = m.Inputs
+	} else {
+		requestMap["input"] = m.Inputs[0]
+	}
+
+	return requestMap
+}
+
+func (m Moderation) ToAuditRequest() audit.Request {
+
+	var inputs []map[string]interface{}
+	for _, message := range m.Messages() {
+		inputs = append(inputs, map[string]interface{}{
+			"role":    message.Role,
+			"content": message.Content,
+		})
+	}
+
+	return audit.Request{
+		UserID:     m.User.ID.String(),
+		APIKeyID:   m.User.APIKeyID.String(),
+		Model:      m.Target.Model.String(),
+		Alias:      m.Model.Name.String(),
+		TargetURL:  m.TargetURL.String(),
+		Inputs:     inputs,
+		Parameters: map[string]interface{}{},
+		ClientIP:   m.ClientIP,
+	}
+}
@@ -1,9 +1,11 @@
 package request
 
 import (
+	"covalence/src/register"
 	"covalence/src/types"
 	"covalence/src/user"
 	"errors"
+	"fmt"
 	"net/url"
 	"time"
 
@@ -12,14 +14,33 @@ import (
 
 // ModelInfo stores information about a registered model
 type rawRegister struct {
-	Name     string  `json:"name" binding:"required"`
-	Model    string  `json:"model" binding:"required"`
-	APIURL   string  `json:"api_url" binding:"required"`
-	Provider string  `json:"provider" binding:"required"`
-	Status   *string `json:"status"`
+	Name      string      `json:"name" binding:"required"`
+	Model     string      `json:"model"`
+	APIURL    string      `json:"api_url"` // Defaults to the provider's api_url in providers.yaml
+	Provider  string      `json:"provider"`
+	Status    *string     `json:"status"`
+	Targets   []rawTarget `json:"targets"`   // Weighted pool, instead of model/provider/api_url
+	Fallbacks []rawTarget `json:"fallbacks"` // Tried in order when the chosen target fails
 }
 
-func ParseRegister(c *gin.Context) (user.Model, error) {
+type rawTarget struct {
+	Model    string `json:"model"`
+	APIURL   string `json:"api_url"`
+	Provider string `json:"provider"`
+	Weight   *int   `json:"weight"`
+}
+
+// rawUpdate holds the fields of a PUT or PATCH to a registered model
+type rawUpdate struct {
+	Model     *string      `json:"model"`
+	APIURL    *string      `json:"api_url"`
+	Provider  *string      `json:"provider"`
+	Status    *string      `json:"status"`
+	Targets   *[]rawTarget `json:"targets"`   // An empty list goes back to a single target
+	Fallbacks *[]rawTarget `json:"fallbacks"` // An empty list removes the fallbacks
+}
+
+func ParseRegister(c *gin.Context, providers *[]register.ModelProvider) (user.Model, error) {
 
 	var r rawRegister
 	if err := c.ShouldBindJSON(&r); err != nil {
@@ -31,39 +52,228 @@ func ParseRegister(c *gin.Context) (user.Model, error) {
 		return user.Model{}, errors.New("invalid name")
 	}
 
-	provider, err := types.NewModelProvider(r.Provider)
+	var status types.Status
+	if r.Status != nil {
+		status, err = parseStatus(*r.Status)
+		if err != nil {
+			return user.Model{}, err
+		}
+	} else {
+		status = types.Active()
+	}
+
+	var targets []user.Target
+	if len(r.Targets) > 0 {
+		if r.Model != "" || r.Provider != "" || r.APIURL != "" {
+			return user.Model{}, errors.New("use either model, provider and api_url or targets")
+		}
+		targets, err = parseTargets(r.Targets, providers)
+	} else {
+		if r.Model == "" || r.Provider == "" {
+			return user.Model{}, errors.New("model and provider are required")
+		}
+		var target user.Target
+		target, err = parseTarget(rawTarget{Model: r.Model, APIURL: r.APIURL, Provider: r.Provider}, providers)
+		targets = []user.Target{target}
+	}
 	if err != nil {
-		return user.Model{}, errors.New("invalid model provider")
+		return user.Model{}, err
 	}
 
-	modelID, err := types.NewModelID(r.Model)
+	fallbacks, err := parseTargets(r.Fallbacks, providers)
 	if err != nil {
-		return user.Model{}, errors.New("invalid model")
+		return user.Model{}, fmt.Errorf("invalid fallback: %w", err)
+	}
+
+	model := user.Model{
+		Name:      name,
+		CreatedAt: time.Now(),
+		Status:    status,
+		Fallbacks: fallbacks,
+	}
+	setTargets(&model, targets)
+
+	return model, nil
+}
+
+// ParseUpdate applies a PUT (partial == false) or PATCH (partial == true) body
+// to the current registration of a model
+func ParseUpdate(c *gin.Context, current user.Model, partial bool, providers *[]register.ModelProvider) (user.Model, error) {
+	var r rawUpdate
+	if err := c.ShouldBindJSON(&r); err != nil {
+		return user.Model{}, err
+	}
+
+	if r.Targets != nil && (r.Model != nil || r.Provider != nil || r.APIURL != nil) {
+		return user.Model{}, errors.New("use either model, provider and api_url or targets")
+	}
+
+	if !partial {
+		if r.Targets == nil && (r.Model == nil || r.Provider == nil) {
+			return user.Model{}, errors.New("model and provider, or targets, are required")
+		}
+		// A full update resets the status and fallbacks unless they are given
+		current.Status = types.Active()
+		current.Fallbacks = nil
+	}
+
+	updated := current
+	var err error
+
+	switch {
+	case r.Targets != nil && len(*r.Targets) > 0:
+		targets, err := parseTargets(*r.Targets, providers)
+		if err != nil {
+			return user.Model{}, err
+		}
+		setTargets(&updated, targets)
+
+	case r.Targets != nil:
+		// Back to routing everything to the primary target
+		updated.Targets = nil
+
+	// Only re-check the catalog when the target changes, so a status change
+	// still works for a model that has since been removed from providers.yaml
+	case r.Model != nil || r.Provider != nil || r.APIURL != nil:
+		raw := rawTarget{Model: current.Model.String(), Provider: current.Provider.String()}
+		if r.Provider == nil {
+			raw.APIURL = current.APIURL.String()
+		}
+		if r.Model != nil {
+			raw.Model = *r.Model
+		}
+		if r.Provider != nil {
+			raw.Provider = *r.Provider
+		}
+		if r.APIURL != nil {
+			raw.APIURL = *r.APIURL
+		}
+
+		target, err := parseTarget(raw, providers)
+		if err != nil {
+			return user.Model{}, err
+		}
+		setTargets(&updated, []user.Target{target})
+	}
+
+	if r.Fallbacks != nil {
+		updated.Fallbacks, err = parseTargets(*r.Fallbacks, providers)
+		if err != nil {
+			return user.Model{}, fmt.Errorf("invalid fallback: %w", err)
+		}
 	}
 
-	var status types.Status
 	if r.Status != nil {
-		status, err = types.NewStatus(*r.Status)
+		updated.Status, err = parseStatus(*r.Status)
 		if err != nil {
-			return user.Model{}, errors.New("invalid status")
+			return user.Model{}, err
 		}
-	} else {
-		status = types.Active()
+	}
+
+	return updated, nil
+}
+
+func parseTargets(raw []rawTarget, providers *[]register.ModelProvider) ([]user.Target, error) {
+	targets := make([]user.Target, 0, len(raw))
+	for _, rt := range raw {
+		target, err := parseTarget(rt, providers)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func parseTarget(rt rawTarget, providers *[]register.ModelProvider) (user.Target, error) {
+	provider, err := parseProvider(rt.Provider)
+	if err != nil {
+		return user.Target{}, err
+	}
+
+	modelID, err := parseModelID(rt.Model)
+	if err != nil {
+		return user.Target{}, err
+	}
+
+	catalogEntry, err := register.ValidateModel(providers, provider, modelID)
+	if err != nil {
+		return user.Target{}, err
 	}
 
 	// Build target URL
-	apiURL, err := url.Parse(r.APIURL)
+	apiURL, err := resolveAPIURL(rt.APIURL, catalogEntry)
 	if err != nil {
-		return user.Model{}, errors.New("invalid api url")
+		return user.Target{}, err
 	}
 
-	return user.Model{
-		Name:      name,
-		Model:     modelID,
-		APIURL:    apiURL,
-		CreatedAt: time.Now(),
-		Provider:  provider,
-		Status:    status,
+	weight := 1
+	if rt.Weight != nil {
+		weight = *rt.Weight
+	}
+	if weight <= 0 {
+		return user.Target{}, errors.New("invalid weight (must be > 0)")
+	}
+
+	return user.Target{
+		Model:    modelID,
+		APIURL:   apiURL,
+		Provider: provider,
+		Weight:   weight,
 	}, nil
+}
+
+// setTargets makes the first target the primary one. A single target is stored
+// as the primary only, so the alias behaves exactly like before pools existed.
+func setTargets(m *user.Model, targets []user.Target) {
+	m.Model = targets[0].Model
+	m.APIURL = targets[0].APIURL
+	m.Provider = targets[0].Provider
+	m.Targets = nil
+	if len(targets) > 1 {
+		m.Targets = targets
+	}
+}
+
+func parseProvider(value string) (types.ModelProvider, error) {
+	provider, err := types.NewModelProvider(value)
+	if err != nil {
+		return types.ModelProvider{}, errors.New("invalid model provider")
+	}
+	return provider, nil
+}
+
+func parseModelID(value string) (types.ModelID, error) {
+	modelID, err := types.NewModelID(value)
+	if err != nil {
+		return types.ModelID{}, errors.New("invalid model")
+	}
+	return modelID, nil
+}
+
+func parseStatus(value string) (types.Status, error) {
+	status, err := types.NewStatus(value)
+	if err != nil {
+		return types.Status{}, errors.New("invalid status")
+	}
+	return status, nil
+}
 
+// resolveAPIURL uses the given api_url, or the provider's api_url when none is given
+func resolveAPIURL(value string, provider register.ModelProvider) (*url.URL, error) {
+	if value == "" {
+		if !provider.APIURL.Complete() {
+			return nil, errors.New("api_url is required for custom models")
+		}
+		value = provider.APIURL.String()
+	}
+	return parseAPIURL(value)
+}
+
+func parseAPIURL(value string) (*url.URL, error) {
+	apiURL, err := url.Parse(value)
+	if err != nil {
+		return nil, errors.New("invalid api url")
+	}
+	return apiURL, nil
 }
@@ -0,0 +1,176 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy decides which upstream failures are retried and how long to wait
+type Policy struct {
+	MaxAttempts int           // Calls per target, including the first
+	BaseDelay   time.Duration // Backoff before the first retry, doubled for each one after
+	MaxDelay    time.Duration // Upper bound for backoff and Retry-After
+	StatusCodes map[int]bool  // Upstream statuses worth retrying
+}
+
+type rawPolicy struct {
+	MaxAttempts *int   `yaml:"max_attempts"`
+	BaseDelay   string `yaml:"base_delay"`
+	MaxDelay    string `yaml:"max_delay"`
+	StatusCodes []int  `yaml:"status_codes"`
+}
+
+type rawConfig struct {
+	Retry *rawPolicy `yaml:"retry"`
+}
+
+// Default retries rate limits and overloaded or unreachable upstreams twice
+func Default() Policy {
+	return Policy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    8 * time.Second,
+		StatusCodes: map[int]bool{
+			http.StatusTooManyRequests:    true,
+			http.StatusBadGateway:         true,
+			http.StatusServiceUnavailable: true,
+			529:                           true, // Anthropic: overloaded
+		},
+	}
+}
+
+// ReadPolicy reads the retry section of a config file. Missing fields keep their defaults.
+func ReadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	var raw rawConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return Policy{}, err
+	}
+
+	policy := Default()
+	if raw.Retry == nil {
+		return policy, nil
+	}
+
+	if raw.Retry.MaxAttempts != nil {
+		if *raw.Retry.MaxAttempts < 1 {
+			return Policy{}, errors.New("retry max_attempts must be at least 1")
+		}
+		policy.MaxAttempts = *raw.Retry.MaxAttempts
+	}
+
+	if raw.Retry.BaseDelay != "" {
+		policy.BaseDelay, err = time.ParseDuration(raw.Retry.BaseDelay)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid retry base_delay: %w", err)
+		}
+	}
+
+	if raw.Retry.MaxDelay != "" {
+		policy.MaxDelay, err = time.ParseDuration(raw.Retry.MaxDelay)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid retry max_delay: %w", err)
+		}
+	}
+
+	if raw.Retry.StatusCodes != nil {
+		policy.StatusCodes = make(map[int]bool, len(raw.Retry.StatusCodes))
+		for _, code := range raw.Retry.StatusCodes {
+			if code < 400 || code > 599 {
+				return Policy{}, fmt.Errorf("invalid retry status code %d", code)
+			}
+			policy.StatusCodes[code] = true
+		}
+	}
+
+	return policy, nil
+}
+
+// Retryable reports whether a failed call is safe to repeat: the connection was
+// reset before a response arrived, or the upstream returned a retryable status.
+// Timeouts and cancellations are not retried.
+func (p Policy) Retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	}
+	return p.StatusCodes[resp.StatusCode]
+}
+
+// Delay returns how long to wait before retry number n (starting at 1). The
+// upstream's Retry-After is used when present, otherwise exponential backoff
+// with jitter. It returns false when the wait would not finish before the
+// context's deadline, or exceeds MaxDelay for Retry-After.
+func (p Policy) Delay(ctx context.Context, n int, resp *http.Response) (time.Duration, bool) {
+	delay, ok := retryAfter(resp)
+	if ok {
+		if delay > p.MaxDelay {
+			return 0, false
+		}
+	} else {
+		delay = p.BaseDelay << (n - 1)
+		if delay <= 0 || delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		// Spread retries from concurrent requests over the second half of the window
+		delay = delay/2 + rand.N(delay/2+1)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// Sleep waits for the delay, returning the context's error if it ends first
+func Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfter reads retry-after-ms or Retry-After (seconds or an HTTP date)
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	if ms, err := strconv.Atoi(resp.Header.Get("Retry-After-Ms")); err == nil && ms >= 0 {
+		return time.Duration(ms) * time.Millisecond, true
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func response(headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestDelay(t *testing.T) {
+	policy := Default()
+
+	tests := []struct {
+		name    string
+		n       int
+		resp    *http.Response
+		timeout time.Duration // 0 for no deadline
+		wantOK  bool
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "retry-after-ms", n: 1, resp: response(map[string]string{"Retry-After-Ms": "1500"}), wantOK: true, min: 1500 * time.Millisecond, max: 1500 * time.Millisecond},
+		{name: "retry-after seconds", n: 1, resp: response(map[string]string{"Retry-After": "2"}), wantOK: true, min: 2 * time.Second, max: 2 * time.Second},
+		{name: "retry-after-ms wins", n: 1, resp: response(map[string]string{"Retry-After-Ms": "100", "Retry-After": "5"}), wantOK: true, min: 100 * time.Millisecond, max: 100 * time.Millisecond},
+		{name: "retry-after date", n: 1, resp: response(map[string]string{"Retry-After": time.Now().Add(4 * time.Second).UTC().Format(http.TimeFormat)}), wantOK: true, min: 2 * time.Second, max: 4 * time.Second},
+		{name: "retry-after date in the past", n: 1, resp: response(map[string]string{"Retry-After": time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}), wantOK: true, min: 0, max: 0},
+		{name: "retry-after over max delay", n: 1, resp: response(map[string]string{"Retry-After": "60"}), wantOK: false},
+		{name: "invalid retry-after backs off", n: 1, resp: response(map[string]string{"Retry-After": "soon"}), wantOK: true, min: 250 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "first backoff", n: 1, wantOK: true, min: 250 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "third backoff", n: 3, resp: response(nil), wantOK: true, min: time.Second, max: 2 * time.Second},
+		{name: "backoff capped at max delay", n: 10, wantOK: true, min: 4 * time.Second, max: 8 * time.Second},
+		{name: "backoff overflow capped at max delay", n: 64, wantOK: true, min: 4 * time.Second, max: 8 * time.Second},
+		{name: "past the deadline", n: 1, resp: response(map[string]string{"Retry-After": "2"}), timeout: time.Second, wantOK: false},
+		{name: "before the deadline", n: 1, resp: response(map[string]string{"Retry-After": "2"}), timeout: time.Minute, wantOK: true, min: 2 * time.Second, max: 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			delay, ok := policy.Delay(ctx, tt.n, tt.resp)
+			if ok != tt.wantOK {
+				t.Fatalf("Delay() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (delay < tt.min || delay > tt.max) {
+				t.Errorf("Delay() = %v, want between %v and %v", delay, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	policy := Default()
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, want: true},
+		{name: "overloaded", status: 529, want: true},
+		{name: "bad request", status: http.StatusBadRequest, want: false},
+		{name: "server error", status: http.StatusInternalServerError, want: false},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "timeout", err: context.DeadlineExceeded, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := policy.Retryable(resp, tt.err); got != tt.want {
+				t.Errorf("Retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/user"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin only lets requests made with the admin API key through. Routes
+// that change the firewalls or the configuration, or read the audit log, use
+// it, as any client key would otherwise be enough to switch off the firewalls
+// screening it.
+func RequireAdmin(adminKey string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			apierror.Write(c, http.StatusUnauthorized, apierror.New(http.StatusUnauthorized, "missing or invalid Authorization header").WithCode(apierror.CodeInvalidAPIKey))
+			c.Abort()
+			return
+		}
+
+		if !user.IsAdminKey(adminKey, strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))) {
+			apierror.Write(c, http.StatusForbidden, apierror.New(http.StatusForbidden, "this endpoint requires the admin API key").WithCode(apierror.CodeAdminRequired))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/archive"
+	"covalence/src/audit"
+	"covalence/src/db/postgres"
+	"covalence/src/db/s3"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyAuditChain checks the audit hash chain and reports the first broken
+// link. It reads every link, so it is slow on large audit logs.
+func VerifyAuditChain(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+
+	report, err := audit.VerifyChain(c.Request.Context(), db)
+	if err != nil {
+		log.Printf("failed to verify audit chain: %v", err)
+		apierror.Abort(c, http.StatusInternalServerError, "failed to verify audit chain")
+		return
+	}
+
+	var broken interface{}
+	if report.Broken != nil {
+		broken = gin.H{
+			"seq":    report.Broken.Seq,
+			"table":  report.Broken.Table,
+			"reason": report.Broken.Reason,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":   report.Valid,
+		"checked": report.Checked,
+		"head":    report.Head,
+		"broken":  broken,
+	})
+}
+
+// RestoreAuditTraces copies requests received in [from, to) back into Postgres
+// from their archives (?from=...&to=..., both RFC 3339)
+func RestoreAuditTraces(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+	store := c.MustGet("archiveStore").(*s3.Client)
+
+	if store == nil {
+		apierror.Abort(c, http.StatusBadRequest, "audit archive is not enabled")
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid from (expected RFC 3339)")
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid to (expected RFC 3339)")
+		return
+	}
+	if !from.Before(to) {
+		apierror.Abort(c, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	restored, err := archive.Restore(c.Request.Context(), db, store, from, to)
+	if err != nil {
+		// Requests restored before the failure stay restored
+		log.Printf("failed to restore audit traces: %v", err)
+		apierror.Abort(c, http.StatusInternalServerError, fmt.Sprintf("failed to restore audit traces (%d restored before the failure)", restored))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": restored})
+}
+
+// AuditTrace returns everything recorded about a request. Requests pruned
+// from Postgres are read back from their archive when it is enabled.
+func AuditTrace(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+	store := c.MustGet("archiveStore").(*s3.Client)
+
+	trace, err := audit.GetTrace(c.Request.Context(), c.Param("id"), db, store)
+	if errors.Is(err, audit.ErrTraceNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "request not found")
+		return
+	}
+	if err != nil {
+		log.Printf("failed to get audit trace: %v", err)
+		apierror.Abort(c, http.StatusInternalServerError, "failed to get audit trace")
+		return
+	}
+
+	events := make([]gin.H, 0, len(trace.FirewallInfo))
+	for _, e := range trace.FirewallInfo {
+		events = append(events, gin.H{
+			"firewall_id":    e.FirewallID,
+			"firewall_type":  e.FirewallType,
+			"mode":           e.Mode,
+			"version":        e.Version,
+			"blocked":        e.Blocked,
+			"blocked_reason": e.BlockedReason,
+			"risk_score":     e.RiskScore,
+		})
+	}
+
+	attempts := make([]gin.H, 0, len(trace.Attempts))
+	for _, a := range trace.Attempts {
+		attempts = append(attempts, gin.H{
+			"attempt":     a.Attempt,
+			"model":       a.Model,
+			"provider":    a.Provider,
+			"target_url":  a.TargetURL,
+			"status_code": a.StatusCode,
+			"error":       a.Error,
+			"latency_ms":  a.LatencyMs,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"request_id":        trace.RequestID,
+		"user_id":           trace.UserID,
+		"model":             trace.Model,
+		"alias":             trace.Alias,
+		"target_url":        trace.TargetURL,
+		"inputs":            trace.Inputs,
+		"parameters":        trace.RequestParameters,
+		"response":          trace.Response,
+		"prompt_tokens":     trace.PromptTokens,
+		"completion_tokens": trace.CompletionTokens,
+		"cost_usd":          trace.CostUSD,
+		"cache_hit":         trace.CacheHit,
+		"cache_similarity":  trace.CacheSimilarity,
+		"client_ip":         trace.ClientIP,
+		"risk_score":        trace.RiskScore,
+		"blocked":           trace.Blocked,
+		"blocked_reason":    trace.BlockedReason,
+		"firewall_events":   events,
+		"attempts":          attempts,
+		"from_archive":      trace.FromArchive,
+	})
+}
@@ -0,0 +1,36 @@
+package router
+
+import (
+	"covalence/src/audit"
+	"covalence/src/cache"
+	"covalence/src/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveCached answers a request from the cache and records the hit. Nothing
+// was spent, so no usage is recorded. Similarity is 0 for exact matches.
+func serveCached(c *gin.Context, auditWriter *audit.Writer, requestID string, entry cache.Entry, similarity float64) {
+	c.Header(cache.Header, cache.Hit)
+	if similarity > 0 {
+		c.Header(cache.SimilarityHeader, strconv.FormatFloat(similarity, 'f', 4, 64))
+	}
+	c.Data(http.StatusOK, entry.ContentType, entry.Body)
+
+	response := audit.ParseResponse(entry.Body, strings.HasPrefix(entry.ContentType, "text/event-stream"))
+
+	utils.BoxLog("audit loggging: response 📝")
+	err := auditWriter.LogResponse(c.Request.Context(), audit.Response{
+		RequestID:       requestID,
+		Response:        response,
+		CacheHit:        true,
+		CacheSimilarity: similarity,
+	})
+	if err != nil {
+		log.Printf("failed to log cached response: %v", err)
+	}
+}
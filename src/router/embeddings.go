@@ -0,0 +1,50 @@
+package router
+
+import (
+	"covalence/src/audit"
+	"covalence/src/firewall"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Embeddings(c *gin.Context, policies *firewall.Policies, hook inputHook) {
+
+	registry := c.MustGet("registry").(*register.Registry)
+
+	metrics := request.Metrics{
+		StartTime: time.Now(),
+	}
+	defer logMetrics(c, &metrics)
+
+	utils.BoxLog(fmt.Sprintf("reading & parsing request made to %s 🚀", c.Param("path")))
+
+	embeddingsRequest, err := request.ParseEmbeddings(c, registry)
+	if err != nil {
+		parseFailed(c, err)
+		return
+	}
+
+	proxyInputs(c, policies, hook, inputEndpoint{
+		Name:   "embeddings",
+		User:   embeddingsRequest.User,
+		Model:  embeddingsRequest.Model,
+		Target: embeddingsRequest.Target,
+		Tokens: int64(embeddingsRequest.PromptTokens),
+		Inputs: embeddingsRequest.Messages(),
+		WithTarget: func(target user.Target) url.URL {
+			embeddingsRequest = embeddingsRequest.WithTarget(target)
+			return embeddingsRequest.TargetURL
+		},
+		Body:  func() map[string]interface{} { return embeddingsRequest.ToMap() },
+		Audit: func() audit.Request { return embeddingsRequest.ToAuditRequest() },
+		// Vectors are large and reveal nothing the inputs don't
+		AuditResponse: func(body []byte) map[string]interface{} { return withoutFields(body, "embedding") },
+	}, &metrics)
+}
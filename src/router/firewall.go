@@ -0,0 +1,394 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/audit"
+	"covalence/src/db/postgres"
+	"covalence/src/firewall"
+	"covalence/src/reload"
+	"covalence/src/request"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func FirewallStats(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+
+	stats, err := audit.GetFirewallStats(c.Request.Context(), db)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "failed to get firewall stats")
+		return
+	}
+
+	firewalls := make([]map[string]interface{}, 0, len(stats))
+	for _, s := range stats {
+		firewalls = append(firewalls, map[string]interface{}{
+			"firewall_id":   s.FirewallID,
+			"firewall_type": s.FirewallType,
+			"mode":          s.Mode,
+			"total":         s.Total,
+			"blocked":       s.Blocked,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"firewalls": firewalls})
+}
+
+// ListFirewallPolicies returns the policies currently in effect, from config.yaml and Postgres
+func ListFirewallPolicies(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	policies := loader.Current().Policies
+
+	configs := []firewall.Config{policies.Default}
+	for _, cfg := range policies.Named {
+		configs = append(configs, cfg)
+	}
+
+	out := make([]map[string]interface{}, 0, len(configs))
+	for _, cfg := range configs {
+		firewalls := make([]map[string]interface{}, 0, len(cfg.Firewalls))
+		for _, f := range cfg.Firewalls {
+			firewalls = append(firewalls, map[string]interface{}{
+				"id":                 f.ID.String(),
+				"enabled":            f.Enabled,
+				"type":               f.Type.String(),
+				"mode":               f.Mode.String(),
+				"model":              f.Model.Model.String(),
+				"blocking_threshold": f.BlockingThreshold,
+				"version":            f.Version,
+			})
+		}
+		out = append(out, map[string]interface{}{
+			"name":      cfg.Name,
+			"default":   cfg.Name == policies.Default.Name,
+			"firewalls": firewalls,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": out})
+}
+
+func CreateFirewallPolicy(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	actor, policy, ok := parsePolicyChange(c)
+	if !ok {
+		return
+	}
+
+	if loader.Current().Policies.Has(policy.Name.String()) {
+		apierror.Abort(c, http.StatusConflict, "policy already exists")
+		return
+	}
+	if !checkPolicyBinding(c, loader, policy) {
+		return
+	}
+
+	stored, err := firewall.CreatePolicy(c.Request.Context(), db, policy, actor)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondPolicyChange(c, loader, http.StatusCreated, stored)
+}
+
+func UpdateFirewallPolicy(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	actor, policy, ok := parsePolicyChange(c)
+	if !ok {
+		return
+	}
+	if !checkPolicyBinding(c, loader, policy) {
+		return
+	}
+
+	stored, err := firewall.UpdatePolicy(c.Request.Context(), db, policy, actor)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondPolicyChange(c, loader, http.StatusOK, stored)
+}
+
+func DeleteFirewallPolicy(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	stored, err := firewall.DeletePolicy(c.Request.Context(), db, c.Param("name"), actor.ID.String())
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondPolicyChange(c, loader, http.StatusOK, stored)
+}
+
+func ListFirewallPolicyVersions(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+
+	versions, err := firewall.PolicyVersions(c.Request.Context(), db, c.Param("name"))
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "failed to list policy versions")
+		return
+	}
+
+	out := make([]map[string]interface{}, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, policyJSON(v))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": out})
+}
+
+func CreateFirewall(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	actor, f, ok := parseFirewallChange(c, loader)
+	if !ok {
+		return
+	}
+
+	stored, err := firewall.CreateFirewall(c.Request.Context(), db, f, actor)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondFirewallChange(c, loader, http.StatusCreated, stored)
+}
+
+func UpdateFirewall(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid firewall id")
+		return
+	}
+
+	actor, f, ok := parseFirewallChange(c, loader)
+	if !ok {
+		return
+	}
+
+	stored, err := firewall.UpdateFirewall(c.Request.Context(), db, id, f, actor)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondFirewallChange(c, loader, http.StatusOK, stored)
+}
+
+func EnableFirewall(c *gin.Context) {
+	setFirewallEnabled(c, true)
+}
+
+func DisableFirewall(c *gin.Context) {
+	setFirewallEnabled(c, false)
+}
+
+func DeleteFirewall(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid firewall id")
+		return
+	}
+
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	stored, err := firewall.DeleteFirewall(c.Request.Context(), db, id, actor.ID.String())
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondFirewallChange(c, loader, http.StatusOK, stored)
+}
+
+func ListFirewallVersions(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid firewall id")
+		return
+	}
+
+	versions, err := firewall.FirewallVersions(c.Request.Context(), db, id)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "failed to list firewall versions")
+		return
+	}
+
+	out := make([]map[string]interface{}, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, firewallJSON(v))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": out})
+}
+
+func setFirewallEnabled(c *gin.Context, enabled bool) {
+	loader := c.MustGet("loader").(*reload.Loader)
+	db := c.MustGet("db").(*postgres.DB)
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "invalid firewall id")
+		return
+	}
+
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	stored, err := firewall.SetFirewallEnabled(c.Request.Context(), db, id, enabled, actor.ID.String())
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+
+	respondFirewallChange(c, loader, http.StatusOK, stored)
+}
+
+func parsePolicyChange(c *gin.Context) (string, request.Policy, bool) {
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return "", request.Policy{}, false
+	}
+
+	policy, err := request.ParsePolicy(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return "", request.Policy{}, false
+	}
+
+	return actor.ID.String(), policy, true
+}
+
+// checkPolicyBinding rejects bindings that overlap another policy's before
+// anything is saved, since a saved policy that can't be loaded would make
+// every reload fail
+func checkPolicyBinding(c *gin.Context, loader *reload.Loader, policy request.Policy) bool {
+	policies := loader.Current().Policies
+	if err := policies.CheckBinding(policy.Name.String(), firewall.PolicyBinding(policy)); err != nil {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return false
+	}
+	return true
+}
+
+func parseFirewallChange(c *gin.Context, loader *reload.Loader) (string, request.Firewall, bool) {
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return "", request.Firewall{}, false
+	}
+
+	f, err := request.ParseFirewall(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return "", request.Firewall{}, false
+	}
+
+	if !loader.Current().Policies.Has(f.Policy.String()) {
+		apierror.Abort(c, http.StatusBadRequest, "policy does not exist")
+		return "", request.Firewall{}, false
+	}
+
+	return actor.ID.String(), f, true
+}
+
+func storeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, firewall.ErrNotFound):
+		apierror.Abort(c, http.StatusNotFound, "not found")
+	case errors.Is(err, firewall.ErrExists), errors.Is(err, firewall.ErrInUse):
+		apierror.Abort(c, http.StatusConflict, err.Error())
+	default:
+		log.Printf("firewall config store error: %v", err)
+		apierror.Abort(c, http.StatusInternalServerError, "failed to save firewall config")
+	}
+}
+
+// reloadAfterChange swaps the saved change in for new requests. The change is
+// already committed, so a failed reload is reported but not rolled back.
+func reloadAfterChange(c *gin.Context, loader *reload.Loader) bool {
+	if err := loader.Reload(); err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "change saved but configuration reload failed: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func respondPolicyChange(c *gin.Context, loader *reload.Loader, status int, p firewall.StoredPolicy) {
+	if !reloadAfterChange(c, loader) {
+		return
+	}
+	c.JSON(status, gin.H{"policy": policyJSON(p)})
+}
+
+func respondFirewallChange(c *gin.Context, loader *reload.Loader, status int, f firewall.StoredFirewall) {
+	if !reloadAfterChange(c, loader) {
+		return
+	}
+	c.JSON(status, gin.H{"firewall": firewallJSON(f)})
+}
+
+func policyJSON(p firewall.StoredPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       p.Name,
+		"api_keys":   p.APIKeys,
+		"users":      p.Users,
+		"models":     p.Models,
+		"version":    p.Version,
+		"deleted":    p.Deleted,
+		"changed_by": p.ChangedBy,
+		"changed_at": p.ChangedAt.Format(time.RFC3339),
+	}
+}
+
+func firewallJSON(f firewall.StoredFirewall) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                 f.ID,
+		"policy":             f.Policy,
+		"enabled":            f.Enabled,
+		"type":               f.Type,
+		"mode":               f.Mode,
+		"model":              f.Model,
+		"blocking_threshold": f.BlockingThreshold,
+		"version":            f.Version,
+		"deleted":            f.Deleted,
+		"changed_by":         f.ChangedBy,
+		"changed_at":         f.ChangedAt.Format(time.RFC3339),
+	}
+}
@@ -2,28 +2,48 @@ package router
 
 import (
 	"context"
+	"covalence/src/apierror"
 	"covalence/src/audit"
+	"covalence/src/cache"
 	"covalence/src/db/postgres"
 	"covalence/src/firewall"
+	"covalence/src/provider"
 	"covalence/src/register"
 	"covalence/src/request"
+	"covalence/src/usage"
+	"covalence/src/user"
 	"covalence/src/utils"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Context, *request.Generate, *firewall.Config) (int, error)) {
+func Generate(c *gin.Context, policies *firewall.Policies, hook func(*gin.Context, *request.Generate, *firewall.Config) (int, error)) {
+	generate(c, policies, hook, request.ParseGenerate)
+}
+
+// Completions handles legacy completions requests, which have a prompt instead of messages
+func Completions(c *gin.Context, policies *firewall.Policies, hook func(*gin.Context, *request.Generate, *firewall.Config) (int, error)) {
+	generate(c, policies, hook, request.ParseCompletion)
+}
+
+// Responses handles Responses API requests, which have input and instructions instead of messages
+func Responses(c *gin.Context, policies *firewall.Policies, hook func(*gin.Context, *request.Generate, *firewall.Config) (int, error)) {
+	generate(c, policies, hook, request.ParseResponse)
+}
+
+func generate(c *gin.Context, policies *firewall.Policies, hook func(*gin.Context, *request.Generate, *firewall.Config) (int, error), parse func(*gin.Context, *register.Registry) (request.Generate, error)) {
 
 	registry := c.MustGet("registry").(*register.Registry)
-	httpClient := c.MustGet("httpClient").(*http.Client)
 	db := c.MustGet("db").(*postgres.DB)
+	auditWriter := c.MustGet("audit").(*audit.Writer)
+	providers := c.MustGet("providers").(*[]register.ModelProvider)
 
 	// ========================= Request Metrics =========================
 
@@ -31,26 +51,8 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 		StartTime: time.Now(),
 	}
 
-	// Defer function to log metrics
-	defer func() {
-		metrics.TotalProcessTime = time.Since(metrics.StartTime)
-
-		logData, _ := json.Marshal(map[string]interface{}{
-			"timestamp":              time.Now().Format(time.RFC3339),
-			"name":                   metrics.Name.String(),
-			"model":                  metrics.Model.String(),
-			"status":                 metrics.StatusCode,
-			"request_preparation_ms": metrics.RequestPreparationTime.Milliseconds(),
-			"hook_time_ms":           metrics.HookTime.Milliseconds(),
-			"body_process_ms":        metrics.RequestBodyTime.Milliseconds(),
-			"upstream_ms":            metrics.UpstreamLatency.Milliseconds(),
-			"total_ms":               metrics.TotalProcessTime.Milliseconds(),
-			"streaming":              metrics.StreamingResponse,
-			"path":                   c.Param("path"),
-		})
-
-		utils.BoxLog(fmt.Sprintf("request_metrics: %s", logData))
-	}()
+	// Log metrics once the request is done
+	defer logMetrics(c, &metrics)
 
 	// ========================= Read & Parse Request =========================
 
@@ -58,9 +60,50 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 
 	requestPreparationStart := time.Now()
 
-	generateRequest, err := request.ParseGenerate(c, registry)
+	generateRequest, err := parse(c, registry)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		parseFailed(c, err)
+		return
+	}
+
+	// The chosen target, then each fallback in order. Only chat requests can
+	// be translated for providers that aren't OpenAI compatible.
+	var targets []user.Target
+	for _, target := range generateRequest.Model.Attempts(generateRequest.Target) {
+		if generateRequest.Format == request.FormatChat || provider.OpenAICompatible(target.Provider) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		apierror.Write(c, http.StatusBadRequest, apierror.New(http.StatusBadRequest, fmt.Sprintf("provider %s does not support %s requests", generateRequest.Target.Provider.String(), generateRequest.Format)).WithParam("model"))
+		return
+	}
+
+	// Check the parameters suit the model and the prompt fits its context
+	// window before paying for the call. The request starts at the first
+	// target it suits, and each fallback is checked again when it is tried.
+	overflow := c.MustGet("overflow").(request.ContextOverflow)
+	requestedMaxTokens := generateRequest.MaxTokens
+	var fitErr error
+	for _, target := range targets {
+		prepared, err := prepareTarget(generateRequest, target, providers, overflow)
+		if err == nil {
+			generateRequest, fitErr = prepared, nil
+			break
+		}
+		if fitErr == nil {
+			fitErr = err
+		}
+	}
+	if fitErr != nil {
+		checkFailed(c, fitErr)
+		return
+	}
+
+	// ========================= Rate Limits & Budgets =========================
+
+	subject, allowed := checkLimits(c, db, generateRequest.User, generateRequest.Model.Name.String(), generateRequest.EstimatedTokens())
+	if !allowed {
 		return
 	}
 
@@ -69,9 +112,9 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 	utils.BoxLog("audit loggging: request 📝")
 
 	auditRequest := generateRequest.ToAuditRequest()
-	requestID, err := audit.LogRequest(c.Request.Context(), auditRequest, db)
+	requestID, err := auditWriter.LogRequest(c.Request.Context(), auditRequest)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log request"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to log request")
 		return
 	}
 
@@ -82,16 +125,19 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 
 	metrics.RequestPreparationTime = time.Since(requestPreparationStart)
 	metrics.Name = generateRequest.Model.Name
-	metrics.Model = generateRequest.Model.Model
+	metrics.Model = generateRequest.Target.Model
 
 	hookStartTime := time.Now()
 
 	// ========================= Run Hook ===========================
 
+	firewallConfig := policies.Resolve(generateRequest.User.APIKeyID, generateRequest.User.ID, generateRequest.Model.Name.String())
+
 	if hook != nil {
+		utils.BoxLog(fmt.Sprintf("using firewall policy %s 🛡️", firewallConfig.Name))
 		utils.BoxLog("entering hook function ✅")
 		if status, err := hook(c, &generateRequest, firewallConfig); err != nil {
-			c.JSON(status, gin.H{"error": err.Error()})
+			apierror.Write(c, status, err)
 			return
 		}
 	} else {
@@ -100,72 +146,112 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 
 	metrics.HookTime = time.Since(hookStartTime)
 
-	// ========================= Build Request =========================
-	utils.BoxLog("building request 🏗️")
+	// ========================= Response Cache =========================
 
-	bodyProcessStart := time.Now()
-	requestData := generateRequest.ToMap()
-	modifiedRequestBody, err := json.Marshal(requestData)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request to json"})
-		return
-	}
+	// Looked up after the firewalls, so the key covers the request as it
+	// would be sent and blocked requests are never answered from the cache
+	responseCache := c.MustGet("cache").(*cache.Cache)
+	cacheConfig := c.MustGet("cacheConfig").(cache.Config)
 
-	// Create context for the request
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 55*time.Second)
-	defer cancel()
-
-	// Create and send the proxied request
-	proxyReq, err := http.NewRequestWithContext(ctx, c.Request.Method, generateRequest.TargetURL.String(), strings.NewReader(string(modifiedRequestBody)))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create request"})
-		return
+	var cacheKey string
+	cacheable := cache.Cacheable(cacheConfig, generateRequest, c.Request.Header)
+	if cacheable {
+		cacheKey, err = cache.Key(generateRequest)
+		if err != nil {
+			log.Printf("failed to build cache key: %v", err)
+			cacheable = false
+		}
 	}
 
-	// Copy important headers
-	safeHeaders := []string{
-		"Authorization", "Content-Type", "Accept", "User-Agent",
-		"OpenAI-Organization", "Anthropic-Version", "X-Request-ID",
+	if cacheable {
+		entry, hit, err := responseCache.Get(c.Request.Context(), cacheConfig, cacheKey)
+		if err != nil {
+			log.Printf("cache lookup failed: %v", err)
+		}
+		if hit {
+			utils.BoxLog(fmt.Sprintf("serving %s from cache 💾", generateRequest.Model.Name.String()))
+			metrics.CacheHit = true
+			metrics.StatusCode = http.StatusOK
+			metrics.StreamingResponse = generateRequest.IsStreaming
+			serveCached(c, auditWriter, requestID, entry, 0)
+			return
+		}
+		c.Header(cache.Header, cache.Miss)
 	}
 
-	for _, header := range safeHeaders {
-		if value := c.GetHeader(header); value != "" {
-			proxyReq.Header.Set(header, value)
+	// Then for a paraphrase of the last user message, if the alias opted in
+	var prompt cache.Prompt
+	semantic := cache.SemanticCacheable(cacheConfig, generateRequest, c.Request.Header)
+	if semantic {
+		prompt, err = cache.EmbedPrompt(cacheConfig, generateRequest)
+		if err != nil {
+			log.Printf("failed to embed prompt for the semantic cache: %v", err)
+			semantic = false
 		}
 	}
 
-	// Ensure proper content type
-	if proxyReq.Header.Get("Content-Type") == "" {
-		proxyReq.Header.Set("Content-Type", "application/json")
+	if semantic {
+		if entry, similarity, hit := responseCache.GetSimilar(cacheConfig, prompt); hit {
+			utils.BoxLog(fmt.Sprintf("serving %s from semantic cache (similarity %.3f) 💾", generateRequest.Model.Name.String(), similarity))
+			metrics.CacheHit = true
+			metrics.StatusCode = http.StatusOK
+			metrics.StreamingResponse = generateRequest.IsStreaming
+			serveCached(c, auditWriter, requestID, entry, similarity)
+			return
+		}
+		c.Header(cache.Header, cache.Miss)
 	}
 
-	// Make the upstream request
-	metrics.RequestBodyTime = time.Since(bodyProcessStart)
+	// ========================= Send Request =========================
+
+	// Create context for the request, shared by every attempt
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 55*time.Second)
+	defer cancel()
 
-	utils.BoxLog(fmt.Sprintf("making request to %s 🚀", generateRequest.TargetURL.String()))
+	// Try each target in turn. The request is left as it was sent to the last target tried.
 	upstreamStart := time.Now()
-	resp, err := httpClient.Do(proxyReq)
+	resp, sent, err := sendWithFallbacks(ctx, c, targets, &metrics, func(target user.Target) (call, error) {
+		// Fitted from the client's max_tokens, not one clamped for an earlier target
+		next := generateRequest
+		next.MaxTokens = requestedMaxTokens
+		prepared, err := prepareTarget(next, target, providers, overflow)
+		if err != nil {
+			return call{Target: target}, fmt.Errorf("%w: %w", errSkipTarget, err)
+		}
+		generateRequest = prepared
+		adapter := provider.For(target.Provider)
+
+		body, err := json.Marshal(adapter.Body(generateRequest))
+		return call{Target: target, TargetURL: generateRequest.TargetURL, Body: body, Adapter: adapter}, err
+	})
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "upstream service unavailable", "message": err.Error()})
+		sendFailed(c, err)
 		return
 	}
+	defer resp.Body.Close()
+
 	metrics.UpstreamLatency = time.Since(upstreamStart)
 	metrics.StatusCode = resp.StatusCode
 	metrics.StreamingResponse = generateRequest.IsStreaming
+	metrics.Model = generateRequest.Target.Model
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Writer.Header().Add(key, value)
-		}
-	}
+	// Usage and the response are still recorded if the client goes away
+	// before the response is sent, or it could skip its budget that way
+	recordCtx := context.WithoutCancel(c.Request.Context())
 
-	// Set the status code
-	c.Writer.WriteHeader(resp.StatusCode)
+	// Error bodies are passed through as the provider sent them
+	adapter := sent.Adapter
+	translate := resp.StatusCode < 300
+
+	// Copy response headers
+	copyHeaders(c, resp)
 
-	// Stream or copy the response body
+	// Stream or copy the response body. Once the status is written nothing
+	// else can be sent, so later failures are only logged.
 	var responseBody []byte
 	if generateRequest.IsStreaming {
+		c.Writer.WriteHeader(resp.StatusCode)
+
 		// For streaming responses, we need to flush after each write
 		flusher, ok := c.Writer.(http.Flusher)
 		if !ok {
@@ -173,57 +259,135 @@ func Generate(c *gin.Context, firewallConfig *firewall.Config, hook func(*gin.Co
 			responseBody, _ = io.ReadAll(resp.Body)
 			c.Writer.Write(responseBody)
 		} else {
+			recorder := &streamRecorder{w: c.Writer, flusher: flusher}
+			var out io.Writer = recorder
+			if translate {
+				out = adapter.Stream(recorder)
+			}
+
 			// Create a buffer for efficient reading
 			buf := make([]byte, 1024)
 			for {
 				n, err := resp.Body.Read(buf)
 				if n > 0 {
-					c.Writer.Write(buf[:n])
-					flusher.Flush()
-					responseBody = append(responseBody, buf[:n]...)
+					out.Write(buf[:n])
 				}
 
 				if err != nil {
 					break
 				}
 			}
+			responseBody = recorder.body
 		}
 	} else {
 		// For non-streaming, just copy the entire response
 		responseBody, _ = io.ReadAll(resp.Body)
 
+		if translate {
+			translated, err := adapter.Response(responseBody)
+			if err != nil {
+				metrics.StatusCode = http.StatusBadGateway
+				// Keep what the provider sent, as it can't be shown to the client
+				if err := auditWriter.LogResponse(recordCtx, audit.Response{
+					RequestID: requestID,
+					Response:  audit.ParseResponse(responseBody, false),
+					LatencyMs: metrics.UpstreamLatency.Milliseconds(),
+				}); err != nil {
+					log.Printf("failed to log response: %v", err)
+				}
+				apierror.Write(c, http.StatusBadGateway, apierror.New(http.StatusBadGateway, "response couldn't be translated: "+err.Error()).WithCode(apierror.CodeUpstreamInvalidResponse))
+				return
+			}
+			responseBody = translated
+		}
+
 		// Write to body
-		_, err := c.Writer.Write(responseBody)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to write response"})
-			return
+		c.Writer.WriteHeader(resp.StatusCode)
+		if _, err := c.Writer.Write(responseBody); err != nil {
+			log.Printf("failed to write response: %v", err)
 		}
 		// Flush the response writer to ensure all data is sent
 		c.Writer.Flush()
 	}
 
-	var response map[string]interface{}
-	err = json.Unmarshal(responseBody, &response)
-	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "response couldn't be parsed"})
-		return
+	// ========================= Usage =========================
+
+	tokens, reported := usage.Parse(responseBody, generateRequest.IsStreaming)
+	var costUSD float64
+	if reported {
+		price := register.FindPrice(providers, generateRequest.Target.Provider, generateRequest.Target.Model)
+		costUSD = price.Cost(tokens.PromptTokens, tokens.CompletionTokens)
+
+		if err := usage.Record(recordCtx, db, subject, tokens, costUSD); err != nil {
+			log.Printf("failed to record usage: %v", err)
+		}
+	}
+
+	// Only successful responses are worth serving again. They are stored under
+	// the target that answered, which is a fallback's if the chosen one failed.
+	entry := cache.Entry{
+		Model:       generateRequest.Target.Model.String(),
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        responseBody,
+	}
+	if cacheable && resp.StatusCode == http.StatusOK {
+		cacheKey, err := cache.Key(generateRequest)
+		if err == nil {
+			err = responseCache.Put(recordCtx, cacheConfig, cacheKey, entry)
+		}
+		if err != nil {
+			log.Printf("failed to cache response: %v", err)
+		}
+	}
+	// A fallback's response is kept out of the semantic cache, whose scope
+	// was computed for the chosen target
+	if semantic && resp.StatusCode == http.StatusOK && generateRequest.Target == targets[0] {
+		responseCache.PutSimilar(cacheConfig, prompt, entry)
 	}
 
+	// Streams are reassembled, and error bodies that aren't JSON kept as text.
+	// An error returned in place of a stream is a single JSON body.
+	response := audit.ParseResponse(responseBody, generateRequest.IsStreaming && translate)
+
 	// Log the response body for debugging purposes
 	utils.BoxLog(fmt.Sprintf("response body: %v", response))
 
 	// Audit log response
 	utils.BoxLog("audit loggging: response 📝")
 	auditResponse := audit.Response{
-		RequestID: requestID,
-		Response:  response,
-		LatencyMs: metrics.UpstreamLatency.Milliseconds(),
+		RequestID:        requestID,
+		Response:         response,
+		LatencyMs:        metrics.UpstreamLatency.Milliseconds(),
+		PromptTokens:     tokens.PromptTokens,
+		CompletionTokens: tokens.CompletionTokens,
+		CostUSD:          costUSD,
 	}
-	err = audit.LogResponse(c.Request.Context(), auditResponse, db)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log response"})
-		return
+	if err := auditWriter.LogResponse(recordCtx, auditResponse); err != nil {
+		log.Printf("failed to log response: %v", err)
+	}
+}
+
+// prepareTarget points the request at a target, then checks its parameters
+// against the target's rules and fits it to the target's context window
+func prepareTarget(generateRequest request.Generate, target user.Target, providers *[]register.ModelProvider, overflow request.ContextOverflow) (request.Generate, error) {
+	generateRequest = generateRequest.WithTarget(target)
+	generateRequest.Rules = register.FindParameterRules(providers, target.Provider, target.Model)
+	if err := generateRequest.CheckParameters(); err != nil {
+		return generateRequest, err
 	}
 
-	resp.Body.Close()
+	limits := register.FindLimits(providers, target.Provider, target.Model)
+	if err := generateRequest.FitContext(limits, overflow); err != nil {
+		return generateRequest, err
+	}
+	return generateRequest, nil
+}
+
+// checkFailed answers a request that doesn't suit any of its targets
+func checkFailed(c *gin.Context, err error) {
+	apiErr := apierror.New(http.StatusBadRequest, err.Error())
+	if errors.Is(err, request.ErrContextExceeded) {
+		apiErr = apiErr.WithCode(apierror.CodeContextLengthExceeded).WithParam("messages")
+	}
+	apierror.Write(c, http.StatusBadRequest, apiErr)
 }
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"covalence/src/audit"
+	"covalence/src/firewall"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Images(c *gin.Context, policies *firewall.Policies, hook inputHook) {
+
+	registry := c.MustGet("registry").(*register.Registry)
+
+	metrics := request.Metrics{
+		StartTime: time.Now(),
+	}
+	defer logMetrics(c, &metrics)
+
+	utils.BoxLog(fmt.Sprintf("reading & parsing request made to %s 🚀", c.Param("path")))
+
+	imageRequest, err := request.ParseImage(c, registry)
+	if err != nil {
+		parseFailed(c, err)
+		return
+	}
+
+	proxyInputs(c, policies, hook, inputEndpoint{
+		Name:   "image generation",
+		User:   imageRequest.User,
+		Model:  imageRequest.Model,
+		Target: imageRequest.Target,
+		Tokens: int64(imageRequest.PromptTokens),
+		Inputs: imageRequest.Messages(),
+		WithTarget: func(target user.Target) url.URL {
+			imageRequest = imageRequest.WithTarget(target)
+			return imageRequest.TargetURL
+		},
+		Body:  func() map[string]interface{} { return imageRequest.ToMap() },
+		Audit: func() audit.Request { return imageRequest.ToAuditRequest() },
+		// Base64 images are kept out of the audit log; URLs are kept
+		AuditResponse: func(body []byte) map[string]interface{} { return withoutFields(body, "b64_json") },
+	}, &metrics)
+}
@@ -0,0 +1,237 @@
+package router
+
+import (
+	"context"
+	"covalence/src/apierror"
+	"covalence/src/audit"
+	"covalence/src/db/postgres"
+	"covalence/src/firewall"
+	"covalence/src/provider"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/types"
+	"covalence/src/usage"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inputHook runs the firewalls over a request's inputs
+type inputHook func(*gin.Context, []types.Message, *firewall.Config) (int, error)
+
+// inputEndpoint describes a parsed request to an endpoint that takes inputs
+// rather than a conversation, such as embeddings. Its body is forwarded as the
+// client sent it, to OpenAI-compatible providers only.
+type inputEndpoint struct {
+	Name       string // Endpoint name for error messages
+	User       user.User
+	Model      user.Model
+	Target     user.Target
+	Tokens     int64           // Estimated tokens, for rate limits
+	Inputs     []types.Message // Each is firewalled on its own
+	WithTarget func(user.Target) url.URL
+	Body       func() map[string]interface{}
+	Audit      func() audit.Request
+
+	// AuditResponse picks what of a successful response is audited. By default all of it is.
+	AuditResponse func(body []byte) map[string]interface{}
+	// Verdict is called with a successful response before it is sent. An error
+	// is sent in its place.
+	Verdict func(c *gin.Context, requestID string, body []byte) (int, error)
+}
+
+// parseFailed answers a request that couldn't be parsed
+func parseFailed(c *gin.Context, err error) {
+	var apiErr *apierror.Error
+	switch {
+	case errors.Is(err, request.ErrUnauthorized):
+		apiErr = apierror.New(http.StatusUnauthorized, err.Error()).WithCode(apierror.CodeInvalidAPIKey)
+	case errors.Is(err, request.ErrModelNotFound):
+		// OpenAI reports unknown models as invalid requests
+		apiErr = apierror.New(http.StatusNotFound, err.Error()).WithCode(apierror.CodeModelNotFound).WithParam("model")
+		apiErr.Type = apierror.TypeInvalidRequest
+	case errors.Is(err, request.ErrModelInactive):
+		apiErr = apierror.New(http.StatusForbidden, err.Error()).WithCode(apierror.CodeModelInactive).WithParam("model")
+	default:
+		apiErr = apierror.New(http.StatusBadRequest, err.Error())
+	}
+	apierror.Write(c, apiErr.Status, apiErr)
+}
+
+// proxyInputs rate limits, audits, firewalls and forwards an input request,
+// then records its usage and response
+func proxyInputs(c *gin.Context, policies *firewall.Policies, hook inputHook, e inputEndpoint, metrics *request.Metrics) {
+
+	db := c.MustGet("db").(*postgres.DB)
+	auditWriter := c.MustGet("audit").(*audit.Writer)
+	providers := c.MustGet("providers").(*[]register.ModelProvider)
+
+	requestPreparationStart := time.Now()
+
+	// Only OpenAI-compatible providers have these endpoints
+	var targets []user.Target
+	for _, target := range e.Model.Attempts(e.Target) {
+		if provider.OpenAICompatible(target.Provider) {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		apierror.Write(c, http.StatusBadRequest, apierror.New(http.StatusBadRequest, fmt.Sprintf("provider %s does not support %s", e.Target.Provider.String(), e.Name)).WithParam("model"))
+		return
+	}
+	e.WithTarget(targets[0])
+
+	// ========================= Rate Limits & Budgets =========================
+
+	subject, allowed := checkLimits(c, db, e.User, e.Model.Name.String(), e.Tokens)
+	if !allowed {
+		return
+	}
+
+	// ========================= Audit: Log Request =========================
+
+	utils.BoxLog("audit loggging: request 📝")
+
+	requestID, err := auditWriter.LogRequest(c.Request.Context(), e.Audit())
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to log request")
+		return
+	}
+
+	// Set RequestID
+	c.Set("requestID", requestID)
+
+	metrics.RequestPreparationTime = time.Since(requestPreparationStart)
+	metrics.Name = e.Model.Name
+	metrics.Model = targets[0].Model
+
+	// ========================= Run Hook ===========================
+
+	hookStartTime := time.Now()
+
+	firewallConfig := policies.Resolve(e.User.APIKeyID, e.User.ID, e.Model.Name.String())
+
+	if hook != nil {
+		utils.BoxLog(fmt.Sprintf("using firewall policy %s 🛡️", firewallConfig.Name))
+		utils.BoxLog("entering hook function ✅")
+		if status, err := hook(c, e.Inputs, firewallConfig); err != nil {
+			apierror.Write(c, status, err)
+			return
+		}
+	} else {
+		utils.BoxLog("no hook function provided ❌")
+	}
+
+	metrics.HookTime = time.Since(hookStartTime)
+
+	// ========================= Send Request =========================
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 55*time.Second)
+	defer cancel()
+
+	upstreamStart := time.Now()
+	resp, sent, err := sendWithFallbacks(ctx, c, targets, metrics, func(target user.Target) (call, error) {
+		targetURL := e.WithTarget(target)
+
+		body, err := json.Marshal(e.Body())
+		return call{Target: target, TargetURL: targetURL, Body: body, Adapter: provider.For(target.Provider)}, err
+	})
+	if err != nil {
+		sendFailed(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	metrics.UpstreamLatency = time.Since(upstreamStart)
+	metrics.StatusCode = resp.StatusCode
+	metrics.Model = sent.Target.Model
+
+	// Usage and the response are still recorded if the client goes away
+	// before the response is sent, or it could skip its budget that way
+	recordCtx := context.WithoutCancel(c.Request.Context())
+
+	responseBody, _ := io.ReadAll(resp.Body)
+
+	var status int
+	var verdictErr error
+	if resp.StatusCode < 300 && e.Verdict != nil {
+		status, verdictErr = e.Verdict(c, requestID, responseBody)
+	}
+
+	if verdictErr != nil {
+		metrics.StatusCode = status
+		apierror.Write(c, status, verdictErr)
+	} else {
+		copyHeaders(c, resp)
+		c.Writer.WriteHeader(resp.StatusCode)
+		if _, err := c.Writer.Write(responseBody); err != nil {
+			log.Printf("failed to write response: %v", err)
+			return
+		}
+	}
+
+	// ========================= Usage =========================
+
+	tokens, reported := usage.Parse(responseBody, false)
+	var costUSD float64
+	if reported {
+		price := register.FindPrice(providers, sent.Target.Provider, sent.Target.Model)
+		costUSD = price.Cost(tokens.PromptTokens, tokens.CompletionTokens)
+
+		if err := usage.Record(recordCtx, db, subject, tokens, costUSD); err != nil {
+			log.Printf("failed to record usage: %v", err)
+		}
+	}
+
+	// ========================= Audit: Log Response =========================
+
+	var response map[string]interface{}
+	if resp.StatusCode < 300 && e.AuditResponse != nil {
+		response = e.AuditResponse(responseBody)
+	} else {
+		response = audit.ParseResponse(responseBody, false)
+	}
+
+	utils.BoxLog("audit loggging: response 📝")
+	err = auditWriter.LogResponse(recordCtx, audit.Response{
+		RequestID:        requestID,
+		Response:         response,
+		LatencyMs:        metrics.UpstreamLatency.Milliseconds(),
+		PromptTokens:     tokens.PromptTokens,
+		CompletionTokens: tokens.CompletionTokens,
+		CostUSD:          costUSD,
+	})
+	if err != nil {
+		log.Printf("failed to log response: %v", err)
+	}
+}
+
+// withoutFields parses a response for the audit log, leaving out the given
+// fields of each entry in its data array, such as vectors or image data
+func withoutFields(body []byte, fields ...string) map[string]interface{} {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return map[string]interface{}{}
+	}
+
+	if data, ok := response["data"].([]interface{}); ok {
+		for _, item := range data {
+			if entry, ok := item.(map[string]interface{}); ok {
+				for _, field := range fields {
+					delete(entry, field)
+				}
+			}
+		}
+	}
+
+	return response
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/db/postgres"
+	"covalence/src/ratelimit"
+	"covalence/src/usage"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkLimits applies the rate limits and monthly budgets to a request, and
+// answers the client if either rejects it. Both fail open when their counters
+// are unreachable. It returns who the request is billed to.
+func checkLimits(c *gin.Context, db *postgres.DB, u user.User, alias string, tokens int64) (usage.Subject, bool) {
+	limiter := c.MustGet("limiter").(*ratelimit.Limiter)
+	rateLimits := c.MustGet("rateLimits").(ratelimit.Config)
+
+	limit, err := limiter.Allow(c.Request.Context(), rateLimits, ratelimit.Subject{
+		APIKeyID: u.APIKeyID.String(),
+		UserID:   u.ID.String(),
+		Model:    alias,
+	}, tokens)
+	if err != nil {
+		log.Printf("rate limit check failed: %v", err)
+	} else {
+		limit.SetHeaders(c.Writer.Header())
+		if !limit.Allowed {
+			utils.BoxLog(fmt.Sprintf("rate limit %s exceeded ⏳", limit.Rule))
+			apierror.Write(c, http.StatusTooManyRequests, apierror.New(http.StatusTooManyRequests, fmt.Sprintf("rate limit %s exceeded", limit.Rule)).WithCode(apierror.CodeRateLimited))
+			return usage.Subject{}, false
+		}
+	}
+
+	budgets := c.MustGet("budgets").([]usage.Budget)
+	subject := usage.Subject{
+		APIKeyID: u.APIKeyID.String(),
+		UserID:   u.ID.String(),
+	}
+
+	var exhausted usage.Exhausted
+	err = usage.Check(c.Request.Context(), db, budgets, subject)
+	if errors.As(err, &exhausted) {
+		status := http.StatusPaymentRequired
+		if exhausted.Tokens {
+			status = http.StatusTooManyRequests
+		}
+		apierror.Write(c, status, apierror.New(status, err.Error()).WithCode(apierror.CodeBudgetExhausted))
+		return usage.Subject{}, false
+	}
+	if err != nil {
+		log.Printf("budget check failed: %v", err)
+	}
+
+	return subject, true
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"covalence/src/request"
+	"covalence/src/utils"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logMetrics logs a finished request's metrics as one JSON line
+func logMetrics(c *gin.Context, metrics *request.Metrics) {
+	metrics.TotalProcessTime = time.Since(metrics.StartTime)
+
+	logData, _ := json.Marshal(map[string]interface{}{
+		"timestamp":              time.Now().Format(time.RFC3339),
+		"name":                   metrics.Name.String(),
+		"model":                  metrics.Model.String(),
+		"status":                 metrics.StatusCode,
+		"request_preparation_ms": metrics.RequestPreparationTime.Milliseconds(),
+		"hook_time_ms":           metrics.HookTime.Milliseconds(),
+		"body_process_ms":        metrics.RequestBodyTime.Milliseconds(),
+		"upstream_ms":            metrics.UpstreamLatency.Milliseconds(),
+		"total_ms":               metrics.TotalProcessTime.Milliseconds(),
+		"streaming":              metrics.StreamingResponse,
+		"attempts":               metrics.Attempts,
+		"retries":                metrics.Retries,
+		"cache_hit":              metrics.CacheHit,
+		"path":                   c.Param("path"),
+	})
+
+	utils.BoxLog(fmt.Sprintf("request_metrics: %s", logData))
+}
@@ -1,8 +1,10 @@
 package router
 
 import (
+	"covalence/src/apierror"
 	"covalence/src/register"
 	"covalence/src/request"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -13,17 +15,29 @@ import (
 func RegisterModel(c *gin.Context) {
 
 	r := c.MustGet("registry").(*register.Registry)
+	providers := c.MustGet("providers").(*[]register.ModelProvider)
 
 	// Parse Request
-	modelInfo, err := request.ParseRegister(c)
+	modelInfo, err := request.ParseRegister(c, providers)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err = r.Register(modelInfo)
+	// Registration stays open to anonymous callers, but is attributed when possible
+	changedBy := "anonymous"
+	if actor, err := request.ParseUser(c); err == nil {
+		changedBy = actor.ID.String()
+	}
+
+	err = r.Register(c.Request.Context(), modelInfo, changedBy)
+	if errors.Is(err, register.ErrModelExists) {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		log.Printf("failed to register model: %v", err)
+		apierror.Abort(c, http.StatusInternalServerError, "failed to save model")
 		return
 	}
 	log.Printf("model registered: %s -> %s at %s", modelInfo.Name.String(), modelInfo.Model.String(), modelInfo.APIURL.String())
@@ -31,21 +45,107 @@ func RegisterModel(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "model registered", "name": modelInfo.Name.String(), "model": modelInfo.Model.String()})
 }
 
+// UpdateModel handles PUT (full replace) and PATCH (partial) updates of a registered model
+func UpdateModel(c *gin.Context) {
+	r := c.MustGet("registry").(*register.Registry)
+	providers := c.MustGet("providers").(*[]register.ModelProvider)
+
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	current, exists := r.GetInfo(c.Param("name"))
+	if !exists {
+		apierror.Abort(c, http.StatusNotFound, "model not found")
+		return
+	}
+
+	modelInfo, err := request.ParseUpdate(c, current, c.Request.Method == http.MethodPatch, providers)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = r.Update(c.Request.Context(), modelInfo, actor.ID.String())
+	if errors.Is(err, register.ErrModelNotFound) {
+		apierror.Abort(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("model updated by %s: %s -> %s at %s (%s)", actor.ID.String(), modelInfo.Name.String(), modelInfo.Model.String(), modelInfo.APIURL.String(), modelInfo.Status.String())
+	c.JSON(http.StatusOK, gin.H{"status": "model updated", "name": modelInfo.Name.String(), "model": modelInfo.Model.String(), "model_status": modelInfo.Status.String()})
+}
+
+func DeleteModel(c *gin.Context) {
+	r := c.MustGet("registry").(*register.Registry)
+
+	actor, err := request.ParseUser(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	name := c.Param("name")
+	err = r.Delete(c.Request.Context(), name, actor.ID.String())
+	if errors.Is(err, register.ErrModelNotFound) {
+		apierror.Abort(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	log.Printf("model deleted by %s: %s", actor.ID.String(), name)
+	c.JSON(http.StatusOK, gin.H{"status": "model deleted", "name": name})
+}
+
+func ModelHistory(c *gin.Context) {
+	r := c.MustGet("registry").(*register.Registry)
+
+	changes, err := r.History(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "failed to get model history")
+		return
+	}
+
+	history := make([]map[string]interface{}, 0, len(changes))
+	for _, change := range changes {
+		history = append(history, map[string]interface{}{
+			"action":     change.Action,
+			"changed_by": change.ChangedBy,
+			"changed_at": change.ChangedAt.Format(time.RFC3339),
+			"before":     change.Before,
+			"after":      change.After,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"name": c.Param("name"), "history": history})
+}
+
 func ListRegisteredModels(c *gin.Context) {
 	r := c.MustGet("registry").(*register.Registry)
 
 	r.Mu.RLock()
 	defer r.Mu.RUnlock()
 
-	models := make([]map[string]string, 0, len(r.Models))
+	models := make([]map[string]interface{}, 0, len(r.Models))
 	for _, info := range r.Models {
-		models = append(models, map[string]string{
+		models = append(models, map[string]interface{}{
 			"name":          info.Name.String(),
 			"model":         info.Model.String(),
 			"registered_at": info.CreatedAt.Format(time.RFC3339),
 			"status":        info.Status.String(),
 			"provider":      info.Provider.String(),
 			"api_url":       info.APIURL.String(),
+			"targets":       register.TargetsToMaps(info.Targets),
+			"fallbacks":     register.TargetsToMaps(info.Fallbacks),
 		})
 	}
 
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"covalence/src/audit"
+	"covalence/src/firewall"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Moderations(c *gin.Context, policies *firewall.Policies, hook inputHook) {
+
+	registry := c.MustGet("registry").(*register.Registry)
+	auditWriter := c.MustGet("audit").(*audit.Writer)
+	moderation := c.MustGet("moderation").(firewall.ModerationConfig)
+
+	metrics := request.Metrics{
+		StartTime: time.Now(),
+	}
+	defer logMetrics(c, &metrics)
+
+	utils.BoxLog(fmt.Sprintf("reading & parsing request made to %s 🚀", c.Param("path")))
+
+	moderationRequest, err := request.ParseModeration(c, registry)
+	if err != nil {
+		parseFailed(c, err)
+		return
+	}
+
+	endpoint := inputEndpoint{
+		Name:   "moderations",
+		User:   moderationRequest.User,
+		Model:  moderationRequest.Model,
+		Target: moderationRequest.Target,
+		Tokens: int64(moderationRequest.PromptTokens),
+		Inputs: moderationRequest.Messages(),
+		WithTarget: func(target user.Target) url.URL {
+			moderationRequest = moderationRequest.WithTarget(target)
+			return moderationRequest.TargetURL
+		},
+		Body:  func() map[string]interface{} { return moderationRequest.ToMap() },
+		Audit: func() audit.Request { return moderationRequest.ToAuditRequest() },
+	}
+
+	if moderation.FoldVerdicts {
+		endpoint.Verdict = func(c *gin.Context, requestID string, body []byte) (int, error) {
+			utils.BoxLog(fmt.Sprintf("audit loggging: moderation verdicts in %s mode 📝", moderation.Mode))
+			return firewall.FoldModeration(c.Request.Context(), auditWriter, requestID, moderation.Mode, body)
+		}
+	}
+
+	proxyInputs(c, policies, hook, endpoint, &metrics)
+}
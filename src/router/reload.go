@@ -0,0 +1,26 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/reload"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Reload(c *gin.Context) {
+	loader := c.MustGet("loader").(*reload.Loader)
+
+	if err := loader.Reload(); err != nil {
+		apierror.Abort(c, http.StatusUnprocessableEntity, "kept previous configuration: "+err.Error())
+		return
+	}
+
+	current := loader.Current()
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "configuration reloaded",
+		"loaded_at": current.LoadedAt.Format(time.RFC3339),
+		"policies":  len(current.Policies.Named) + 1,
+	})
+}
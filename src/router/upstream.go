@@ -0,0 +1,243 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"covalence/src/apierror"
+	"covalence/src/audit"
+	"covalence/src/provider"
+	"covalence/src/register"
+	"covalence/src/request"
+	"covalence/src/retry"
+	"covalence/src/user"
+	"covalence/src/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers copied from the client request to the upstream request
+var safeHeaders = []string{
+	"Authorization", "Content-Type", "Accept", "User-Agent",
+	"OpenAI-Organization", "Anthropic-Version", "X-Request-ID",
+}
+
+// errBuildRequest marks failures to prepare a call, as opposed to failed calls
+var errBuildRequest = errors.New("failed to build upstream request")
+
+// errSkipTarget is returned by a build function for a target the request
+// can't be sent to, such as a fallback with a smaller context window
+var errSkipTarget = errors.New("request does not suit target")
+
+// call is a request prepared for one target, in that target provider's format
+type call struct {
+	Target    user.Target
+	TargetURL url.URL
+	Body      []byte
+	Adapter   provider.Adapter
+}
+
+// sendUpstream sends a prepared call to its target
+func sendUpstream(ctx context.Context, c *gin.Context, httpClient *http.Client, next call, apiKey string) (*http.Response, error) {
+	targetURL := next.TargetURL
+	targetURL.Path = next.Adapter.Path(targetURL.Path)
+
+	proxyReq, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL.String(), bytes.NewReader(next.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Copy important headers
+	for _, header := range safeHeaders {
+		if value := c.GetHeader(header); value != "" {
+			proxyReq.Header.Set(header, value)
+		}
+	}
+	next.Adapter.Headers(proxyReq.Header, apiKey)
+
+	// Ensure proper content type
+	if proxyReq.Header.Get("Content-Type") == "" {
+		proxyReq.Header.Set("Content-Type", "application/json")
+	}
+
+	return httpClient.Do(proxyReq)
+}
+
+// sendWithRetries calls one target, repeating calls that failed in a way the
+// policy deems safe to retry. onAttempt is called after every call.
+func sendWithRetries(ctx context.Context, c *gin.Context, httpClient *http.Client, next call, apiKey string, policy retry.Policy, onAttempt func(*http.Response, error, time.Duration)) (*http.Response, error) {
+	for n := 1; ; n++ {
+		start := time.Now()
+		resp, err := sendUpstream(ctx, c, httpClient, next, apiKey)
+		onAttempt(resp, err, time.Since(start))
+
+		if n >= policy.MaxAttempts || !policy.Retryable(resp, err) {
+			return resp, err
+		}
+
+		delay, ok := policy.Delay(ctx, n, resp)
+		if !ok {
+			return resp, err
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		utils.BoxLog(fmt.Sprintf("retrying %s in %s 🔁", next.Target.Model.String(), delay))
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sendWithFallbacks calls each target in turn, with retries, until one answers
+// without a reason to fall back. build prepares the call for a target, and
+// targets it returns errSkipTarget for are passed over. Nothing is written to
+// the client here, so retries never repeat a stream.
+func sendWithFallbacks(ctx context.Context, c *gin.Context, targets []user.Target, metrics *request.Metrics, build func(user.Target) (call, error)) (*http.Response, call, error) {
+	httpClient := c.MustGet("httpClient").(*http.Client)
+	auditWriter := c.MustGet("audit").(*audit.Writer)
+	providers := c.MustGet("providers").(*[]register.ModelProvider)
+	policy := c.MustGet("retry").(retry.Policy)
+	requestID := c.MustGet("requestID").(string)
+
+	var resp *http.Response
+	var sent call
+	var err error
+	tried := 0
+	for i, target := range targets {
+		// Build the request in the target provider's format
+		utils.BoxLog("building request 🏗️")
+		bodyProcessStart := time.Now()
+		next, buildErr := build(target)
+		if errors.Is(buildErr, errSkipTarget) {
+			// The previous target's answer stands if no later one can be tried
+			utils.BoxLog(fmt.Sprintf("skipping %s: %v ↩️", target.Model.String(), buildErr))
+			if resp == nil && err == nil {
+				err = buildErr
+			}
+			continue
+		}
+		if buildErr != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, next, fmt.Errorf("%w: %v", errBuildRequest, buildErr)
+		}
+		metrics.RequestBodyTime += time.Since(bodyProcessStart)
+
+		// Replaces the answer of the target it fell back from
+		if resp != nil {
+			resp.Body.Close()
+		}
+		sent = next
+		tried++
+
+		utils.BoxLog(fmt.Sprintf("making request to %s (target %d/%d) 🚀", next.TargetURL.String(), i+1, len(targets)))
+		apiKey := upstreamAPIKey(c, providers, target)
+		resp, err = sendWithRetries(ctx, c, httpClient, next, apiKey, policy, func(resp *http.Response, err error, latency time.Duration) {
+			metrics.Attempts++
+			logAttempt(c, auditWriter, requestID, int32(metrics.Attempts), next, resp, err, latency)
+		})
+		metrics.Retries = metrics.Attempts - tried
+
+		if !shouldFailover(resp, err) || i == len(targets)-1 || ctx.Err() != nil {
+			break
+		}
+
+		utils.BoxLog(fmt.Sprintf("%s failed, falling back to %s ↩️", target.Model.String(), targets[i+1].Model.String()))
+	}
+
+	return resp, sent, err
+}
+
+// sendFailed answers a request whose upstream call couldn't be made or completed
+func sendFailed(c *gin.Context, err error) {
+	if errors.Is(err, errBuildRequest) {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to process request to json")
+		return
+	}
+	if errors.Is(err, errSkipTarget) {
+		checkFailed(c, err)
+		return
+	}
+	apierror.Write(c, http.StatusBadGateway, apierror.New(http.StatusBadGateway, "upstream service unavailable: "+err.Error()).WithCode(apierror.CodeUpstreamUnavailable))
+}
+
+// copyHeaders copies the upstream response headers, except the length as the
+// body may be translated, and headers the proxy already set, such as its own rate limits
+func copyHeaders(c *gin.Context, resp *http.Response) {
+	for key, values := range resp.Header {
+		if key == "Content-Length" || c.Writer.Header().Get(key) != "" {
+			continue
+		}
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+}
+
+// logAttempt records one upstream call in the request's trace
+func logAttempt(c *gin.Context, auditWriter *audit.Writer, requestID string, n int32, next call, resp *http.Response, err error, latency time.Duration) {
+	attempt := audit.Attempt{
+		RequestID: requestID,
+		Attempt:   n,
+		Model:     next.Target.Model.String(),
+		Provider:  next.Target.Provider.String(),
+		TargetURL: next.TargetURL.String(),
+		LatencyMs: latency.Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		attempt.StatusCode = resp.StatusCode
+		if shouldFailover(resp, nil) {
+			attempt.Error = fmt.Sprintf("upstream returned %d", resp.StatusCode)
+		}
+	}
+
+	if err := auditWriter.LogAttempt(c.Request.Context(), attempt); err != nil {
+		log.Printf("failed to log upstream attempt: %v", err)
+	}
+}
+
+// upstreamAPIKey is the provider's own key from providers.yaml, falling back to
+// the client's bearer token
+func upstreamAPIKey(c *gin.Context, providers *[]register.ModelProvider, target user.Target) string {
+	if p, ok := register.FindModelProvider(providers, target.Provider); ok {
+		if key := p.APIKey(); key != "" {
+			return key
+		}
+	}
+	return strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+}
+
+// shouldFailover reports whether the next target should be tried. Nothing has
+// been written to the client at this point, so this is safe for streams too.
+func shouldFailover(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// streamRecorder writes to the client, flushing each write, and keeps a copy for the audit log
+type streamRecorder struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	body    []byte
+}
+
+func (s *streamRecorder) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.flusher.Flush()
+	s.body = append(s.body, p[:n]...)
+	return n, err
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"covalence/src/apierror"
+	"covalence/src/db/postgres"
+	"covalence/src/usage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListUsage returns token usage and spend per user and API key for a month
+// (?month=YYYY-MM, defaulting to the current month)
+func ListUsage(c *gin.Context) {
+	db := c.MustGet("db").(*postgres.DB)
+
+	month := usage.MonthStart(time.Now())
+	if value := c.Query("month"); value != "" {
+		parsed, err := time.Parse("2006-01", value)
+		if err != nil {
+			apierror.Abort(c, http.StatusBadRequest, "invalid month (expected YYYY-MM)")
+			return
+		}
+		month = parsed
+	}
+
+	totals, err := usage.List(c.Request.Context(), db, month)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "failed to get usage")
+		return
+	}
+
+	out := make([]map[string]interface{}, 0, len(totals))
+	for _, t := range totals {
+		out = append(out, map[string]interface{}{
+			"scope":             t.Scope,
+			"subject":           t.Subject,
+			"requests":          t.Requests,
+			"prompt_tokens":     t.PromptTokens,
+			"completion_tokens": t.CompletionTokens,
+			"cost_usd":          t.CostUSD,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"month": month.Format("2006-01"), "usage": out})
+}
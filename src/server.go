@@ -2,14 +2,22 @@ package server
 
 import (
 	"context"
+	"covalence/src/archive"
+	"covalence/src/audit"
+	"covalence/src/cache"
 	"covalence/src/db/postgres"
+	"covalence/src/db/s3"
 	"covalence/src/firewall"
-	"covalence/src/internal"
+	"covalence/src/ratelimit"
 	"covalence/src/register"
+	"covalence/src/reload"
 	"covalence/src/router"
+	"covalence/src/user"
 	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,33 +30,75 @@ func Start() {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 
-	// Create model registry
-	registry := register.NewModelRegistry()
+	// Load Audit DB
+	// Connect to database
+	db, err := postgres.New(ctx, "user=alialh dbname=covalence_dev sslmode=disable")
+	if err != nil {
+		log.Fatal("Database connection failed:", err)
+	}
+	defer db.Close()
 
-	// Load Model Providers
-	modelProviders, err := register.ReadModelProviders()
+	// Load Model Providers, Internal Models and Firewall Config
+	loader, err := reload.NewLoader("config.yaml", "models.yaml", "providers.yaml", db)
 	if err != nil {
-		log.Fatalf("failed to load model providers: %v", err)
+		log.Fatalf("failed to load configuration: %v", err)
 		return
 	}
 
-	// Load Internal Models
-	internal.LoadModels("models.yaml")
+	// Reload on SIGHUP, when any of the files change, or when any instance
+	// changes the firewalls stored in Postgres
+	loader.WatchSignals(ctx)
+	loader.WatchFiles(ctx, 5*time.Second)
+	loader.WatchStoredFirewalls(ctx)
 
-	// Load Firewall Config
-	firewallConfig, err := firewall.LoadConfig("config.yaml")
+	// Load model registry and follow changes made by other instances
+	registry, err := register.LoadModelRegistry(ctx, db)
 	if err != nil {
-		log.Fatalf("failed to load firewall config: %v", err)
+		log.Fatalf("failed to load model registry: %v", err)
 		return
 	}
+	registry.Listen(ctx)
 
-	// Load Audit DB
-	// Connect to database
-	db, err := postgres.New(ctx, "user=alialh dbname=covalence_dev sslmode=disable")
+	// Rate limit counters outlive config reloads
+	limiter := ratelimit.NewLimiter(db)
+
+	// So do cached responses
+	responseCache := cache.New(db)
+
+	// Audit records are written in batches off the request path
+	auditConfig, err := audit.ReadWriterConfig("config.yaml")
 	if err != nil {
-		log.Fatal("Database connection failed:", err)
+		log.Fatalf("failed to load audit config: %v", err)
+		return
 	}
-	defer db.Close()
+	auditWriter := audit.NewWriter(db, auditConfig)
+
+	// Archive audit traces to object storage in the background
+	archiveConfig, err := archive.ReadConfig("config.yaml")
+	if err != nil {
+		log.Fatalf("failed to load archive config: %v", err)
+		return
+	}
+	var archiveStore *s3.Client
+	if archiveConfig.Enabled {
+		archiveStore, err = s3.Connect(archiveConfig.S3)
+		if err != nil {
+			log.Fatalf("failed to connect to archive storage: %v", err)
+			return
+		}
+		archive.New(db, archiveStore, archiveConfig).Start(ctx)
+	}
+
+	// Changes to the firewalls and the admin routes need the admin API key
+	adminKey, err := user.ReadAdminKey("config.yaml")
+	if err != nil {
+		log.Fatalf("failed to load admin config: %v", err)
+		return
+	}
+	if adminKey == "" {
+		log.Printf("no admin API key configured, firewall changes and admin routes are disabled")
+	}
+	requireAdmin := router.RequireAdmin(adminKey)
 
 	// Create a custom HTTP client with connection pooling
 	httpClient := &http.Client{
@@ -63,9 +113,20 @@ func Start() {
 	// Model registration endpoint
 	r.POST("/model/register", func(c *gin.Context) {
 		c.Set("registry", registry)
+		c.Set("providers", loader.Current().Providers)
 		router.RegisterModel(c)
 	})
 
+	// Update, deactivate and delete registered models
+	models := r.Group("/model", func(c *gin.Context) {
+		c.Set("registry", registry)
+		c.Set("providers", loader.Current().Providers)
+	})
+	models.PUT("/:name", router.UpdateModel)
+	models.PATCH("/:name", router.UpdateModel)
+	models.DELETE("/:name", router.DeleteModel)
+	models.GET("/:name/history", router.ModelHistory)
+
 	// List registered models endpoint
 	r.GET("/model/list", func(c *gin.Context) {
 		c.Set("registry", registry)
@@ -74,10 +135,68 @@ func Start() {
 
 	// List registered models endpoint
 	r.GET("/model/list/providers", func(c *gin.Context) {
-		c.Set("providers", modelProviders)
+		c.Set("providers", loader.Current().Providers)
 		router.ListModelProviders(c)
 	})
 
+	// Firewall verdict counts per mode
+	r.GET("/firewall/stats", func(c *gin.Context) {
+		c.Set("db", db)
+		router.FirewallStats(c)
+	})
+
+	// Token usage and spend per user and API key
+	r.GET("/usage", func(c *gin.Context) {
+		c.Set("db", db)
+		router.ListUsage(c)
+	})
+
+	// Firewall policy and firewall config API
+	firewalls := r.Group("/firewall", func(c *gin.Context) {
+		c.Set("loader", loader)
+		c.Set("db", db)
+	})
+	firewalls.GET("/policies", router.ListFirewallPolicies)
+	firewalls.POST("/policies", requireAdmin, router.CreateFirewallPolicy)
+	firewalls.PUT("/policies/:name", requireAdmin, router.UpdateFirewallPolicy)
+	firewalls.DELETE("/policies/:name", requireAdmin, router.DeleteFirewallPolicy)
+	firewalls.GET("/policies/:name/versions", router.ListFirewallPolicyVersions)
+	firewalls.POST("/firewalls", requireAdmin, router.CreateFirewall)
+	firewalls.PUT("/firewalls/:id", requireAdmin, router.UpdateFirewall)
+	firewalls.POST("/firewalls/:id/enable", requireAdmin, router.EnableFirewall)
+	firewalls.POST("/firewalls/:id/disable", requireAdmin, router.DisableFirewall)
+	firewalls.DELETE("/firewalls/:id", requireAdmin, router.DeleteFirewall)
+	firewalls.GET("/firewalls/:id/versions", router.ListFirewallVersions)
+
+	// Admin routes
+	admin := r.Group("/admin", requireAdmin)
+
+	// Reload configuration files
+	admin.POST("/reload", func(c *gin.Context) {
+		c.Set("loader", loader)
+		router.Reload(c)
+	})
+
+	// Check the audit log's hash chain for tampering
+	admin.GET("/audit/verify", func(c *gin.Context) {
+		c.Set("db", db)
+		router.VerifyAuditChain(c)
+	})
+
+	// A request's full trace, read from its archive if it was pruned
+	admin.GET("/audit/traces/:id", func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("archiveStore", archiveStore)
+		router.AuditTrace(c)
+	})
+
+	// Bring archived audit traces back into Postgres for investigations
+	admin.POST("/audit/restore", func(c *gin.Context) {
+		c.Set("db", db)
+		c.Set("archiveStore", archiveStore)
+		router.RestoreAuditTraces(c)
+	})
+
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
 		router.Health(c)
@@ -88,15 +207,61 @@ func Start() {
 		c.Set("registry", registry)
 		c.Set("httpClient", httpClient)
 		c.Set("db", db)
+		c.Set("audit", auditWriter)
+
+		// Each request keeps the snapshot it started with
+		snapshot := loader.Current()
+		c.Set("providers", snapshot.Providers)
+		c.Set("retry", snapshot.Retry)
+		c.Set("limiter", limiter)
+		c.Set("rateLimits", snapshot.RateLimits)
+		c.Set("budgets", snapshot.Budgets)
+		c.Set("overflow", snapshot.Overflow)
+		c.Set("cache", responseCache)
+		c.Set("cacheConfig", snapshot.Cache)
+		c.Set("moderation", snapshot.Moderation)
 
-		router.Generate(c, &firewallConfig, firewall.HookFirewalls)
+		// Endpoints that don't take chat messages have their own request types
+		switch c.Param("path") {
+		case "/embeddings":
+			router.Embeddings(c, &snapshot.Policies, firewall.HookInputs)
+		case "/completions":
+			router.Completions(c, &snapshot.Policies, firewall.HookFirewalls)
+		case "/responses":
+			router.Responses(c, &snapshot.Policies, firewall.HookFirewalls)
+		case "/moderations":
+			router.Moderations(c, &snapshot.Policies, firewall.HookInputs)
+		case "/images/generations":
+			router.Images(c, &snapshot.Policies, firewall.HookInputs)
+		default:
+			router.Generate(c, &snapshot.Policies, firewall.HookFirewalls)
+		}
 	})
 
 	port := 8080
 
 	// Start server
-	log.Printf("starting ai model proxy server on :%d", port)
-	if err := r.Run(fmt.Sprintf(":%d", port)); err != nil {
-		log.Fatalf("failed to start server: %v", err)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: r}
+	go func() {
+		log.Printf("starting ai model proxy server on :%d", port)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to start server: %v", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, finish the requests in flight, then write out
+	// their audit records before exiting
+	stop, cancel := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Println("shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(ctx, 60*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to finish requests in flight: %v", err)
+	}
+	if err := auditWriter.Close(shutdownCtx); err != nil {
+		log.Printf("failed to flush audit records: %v", err)
 	}
 }
@@ -0,0 +1,70 @@
+package tokenizer
+
+import (
+	"covalence/src/types"
+	"unicode"
+)
+
+// Per-message overhead of the chat format: 3 tokens framing each message and
+// 3 priming the assistant's reply
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// Count estimates the tokens in text for BPE tokenizers like the ones used by
+// OpenAI and Anthropic. Letters are about one token per four characters, digits
+// one per three, CJK characters and symbols one each. It errs on the high side,
+// which is the safe direction for a pre-flight check.
+func Count(text string) int {
+	tokens := 0
+	letters, digits := 0, 0
+
+	flush := func() {
+		tokens += (letters+3)/4 + (digits+2)/3
+		letters, digits = 0, 0
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r):
+			if digits > 0 {
+				flush()
+			}
+			letters++
+		case unicode.IsDigit(r):
+			if letters > 0 {
+				flush()
+			}
+			digits++
+		case r == ' ':
+			// A single space is merged into the next word's token
+			flush()
+		case unicode.IsSpace(r):
+			flush()
+			tokens++
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// CountMessages estimates the prompt tokens of a chat request
+func CountMessages(messages []types.Message) int {
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage + Count(msg.Role) + Count(msg.Content)
+	}
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
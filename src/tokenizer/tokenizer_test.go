@@ -0,0 +1,56 @@
+package tokenizer
+
+import (
+	"covalence/src/types"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"short word", "hi", 1},
+		{"word", "hello", 2},
+		{"words share their space", "hello world", 4},
+		{"digits", "12345", 2},
+		{"letters then digits", "abc123", 2},
+		{"cjk", "日本語", 3},
+		{"punctuation", "hi!", 2},
+		{"newline", "a\nb", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Count(tt.text); got != tt.want {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []types.Message
+		want     int
+	}{
+		{"no messages", nil, tokensPerReply},
+		{"one message", []types.Message{{Role: "user", Content: "hello"}}, tokensPerReply + tokensPerMessage + 1 + 2},
+		{
+			"two messages",
+			[]types.Message{{Role: "system", Content: "hi"}, {Role: "user", Content: "hello world"}},
+			tokensPerReply + 2*tokensPerMessage + (2 + 1) + (1 + 4),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountMessages(tt.messages); got != tt.want {
+				t.Errorf("CountMessages() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
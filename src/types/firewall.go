@@ -40,3 +40,45 @@ func NewFirewallType(value string) (FirewallType, error) {
 	}
 	return FirewallType{value}, nil
 }
+
+// ========================= FirewallMode =========================
+
+type FirewallMode struct {
+	raw string
+}
+
+func (s FirewallMode) Complete() bool {
+	return s.raw != ""
+}
+
+func (s FirewallMode) String() string {
+	return s.raw
+}
+
+// Enforce firewalls reject the request when they block
+func Enforce() FirewallMode {
+	return FirewallMode{"enforce"}
+}
+
+// Monitor firewalls only record what they would have blocked
+func Monitor() FirewallMode {
+	return FirewallMode{"monitor"}
+}
+
+func (s FirewallMode) IsMonitor() bool {
+	return s.raw == "monitor"
+}
+
+func isValidFirewallMode(value string) bool {
+	return value == "enforce" || value == "monitor"
+}
+
+func NewFirewallMode(value string) (FirewallMode, error) {
+	if value == "" {
+		return FirewallMode{}, errors.New("firewall mode cannot be empty")
+	}
+	if !isValidFirewallMode(value) {
+		return FirewallMode{}, fmt.Errorf("invalid firewall mode: %s", value)
+	}
+	return FirewallMode{value}, nil
+}
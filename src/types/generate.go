@@ -16,17 +16,15 @@ func (s MaxTokens) Int() int {
 	return s.value
 }
 
+// Only checks > 0. The upper bound is the model's, or request.DefaultMaxOutputTokens.
 func isValidMaxTokens(value int) bool {
-	if value <= 0 || value > 32000 {
-		return false
-	}
-	return true
+	return value > 0
 }
 
 func NewMaxTokens(value int) (MaxTokens, error) {
 	// Just validate - let API handle defaults
 	if !isValidMaxTokens(value) {
-		return MaxTokens{}, errors.New("invalid max_tokens value (must be > 0 and <= 32000)")
+		return MaxTokens{}, errors.New("invalid max_tokens value (must be > 0)")
 	}
 	return MaxTokens{value}, nil
 }
@@ -45,17 +43,15 @@ func (s Temperature) Float32() float32 {
 	return s.value
 }
 
+// The upper bound depends on the model: 2 unless providers.yaml says otherwise
 func isValidTemperature(value float32) bool {
-	if value < 0 || value > 2 {
-		return false
-	}
-	return true
+	return value >= 0
 }
 
 func NewTemperature(value float32) (Temperature, error) {
 	// Just validate - let API handle defaults
 	if !isValidTemperature(value) {
-		return Temperature{}, errors.New("invalid temperature value (must be between 0 and 2)")
+		return Temperature{}, errors.New("invalid temperature value (must be >= 0)")
 	}
 	return Temperature{value}, nil
 }
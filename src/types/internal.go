@@ -19,7 +19,7 @@ func (s InternalModelType) String() string {
 }
 
 func isValidInternalModelType(value string) bool {
-	return value == "text-classification" || value == "image-classification"
+	return value == "text-classification" || value == "image-classification" || value == "embedding"
 }
 
 func NewInternalModelType(value string) (InternalModelType, error) {
@@ -89,6 +89,11 @@ func (s ModelProvider) String() string {
 	return s.raw
 }
 
+// CustomProvider is for models that are not in the providers.yaml catalog
+func CustomProvider() ModelProvider {
+	return ModelProvider{"custom"}
+}
+
 func isValidModelProvider(value string) bool {
 	validTypes := map[string]struct{}{
 		"openai":    {},
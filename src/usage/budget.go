@@ -0,0 +1,234 @@
+package usage
+
+import (
+	"context"
+	"covalence/src/db/postgres"
+	"covalence/src/db/postgres/sqlc"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"gopkg.in/yaml.v3"
+)
+
+// Scope is what usage is totalled by
+type Scope string
+
+const (
+	ScopeAPIKey Scope = "api_key"
+	ScopeUser   Scope = "user"
+)
+
+// Wildcard gives every user or API key its own budget
+const Wildcard = "*"
+
+// Budget caps monthly tokens and/or spend. A limit of 0 is unlimited.
+type Budget struct {
+	Name          string
+	Scope         Scope
+	Match         string // User or API key ID, or * for each one
+	MonthlyTokens int64
+	MonthlyUSD    float64
+}
+
+// Exhausted explains which budget ran out
+type Exhausted struct {
+	Budget string
+	Tokens bool // true for the token limit, false for the dollar limit
+}
+
+func (e Exhausted) Error() string {
+	if e.Tokens {
+		return fmt.Sprintf("monthly token budget %s exhausted", e.Budget)
+	}
+	return fmt.Sprintf("monthly spend budget %s exhausted", e.Budget)
+}
+
+// Total is a user's or API key's usage in one month
+type Total struct {
+	Scope            string
+	Subject          string
+	Month            time.Time
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	CostUSD          float64
+}
+
+// Subject is who a request is billed to
+type Subject struct {
+	APIKeyID string
+	UserID   string
+}
+
+type rawBudget struct {
+	Name          string  `yaml:"name"`
+	Scope         string  `yaml:"scope"`
+	Match         string  `yaml:"match"`
+	MonthlyTokens int64   `yaml:"monthly_tokens"`
+	MonthlyUSD    float64 `yaml:"monthly_usd"`
+}
+
+type rawConfig struct {
+	Budgets []rawBudget `yaml:"budgets"`
+}
+
+// ReadBudgets reads the budgets section of a config file
+func ReadBudgets(path string) ([]Budget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw rawConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	budgets := make([]Budget, 0, len(raw.Budgets))
+	for _, rb := range raw.Budgets {
+		if rb.Name == "" {
+			return nil, errors.New("budget name is required")
+		}
+
+		scope := Scope(rb.Scope)
+		if scope != ScopeAPIKey && scope != ScopeUser {
+			return nil, fmt.Errorf("budget %s: invalid scope %q (must be api_key or user)", rb.Name, rb.Scope)
+		}
+
+		if rb.MonthlyTokens < 0 || rb.MonthlyUSD < 0 {
+			return nil, fmt.Errorf("budget %s: limits cannot be negative", rb.Name)
+		}
+		if rb.MonthlyTokens == 0 && rb.MonthlyUSD == 0 {
+			return nil, fmt.Errorf("budget %s: monthly_tokens or monthly_usd is required", rb.Name)
+		}
+
+		match := rb.Match
+		if match == "" {
+			match = Wildcard
+		}
+
+		budgets = append(budgets, Budget{
+			Name:          rb.Name,
+			Scope:         scope,
+			Match:         match,
+			MonthlyTokens: rb.MonthlyTokens,
+			MonthlyUSD:    rb.MonthlyUSD,
+		})
+	}
+
+	return budgets, nil
+}
+
+// Check returns an Exhausted error if the subject has used up any budget that applies to it this month
+func Check(ctx context.Context, db *postgres.DB, budgets []Budget, subject Subject) error {
+	month := MonthStart(time.Now())
+
+	for _, b := range budgets {
+		value := subject.UserID
+		if b.Scope == ScopeAPIKey {
+			value = subject.APIKeyID
+		}
+		if value == "" || (b.Match != Wildcard && b.Match != value) {
+			continue
+		}
+
+		used, err := Monthly(ctx, db, b.Scope, value, month)
+		if err != nil {
+			return err
+		}
+
+		if b.MonthlyTokens > 0 && used.PromptTokens+used.CompletionTokens >= b.MonthlyTokens {
+			return Exhausted{Budget: b.Name, Tokens: true}
+		}
+		if b.MonthlyUSD > 0 && used.CostUSD >= b.MonthlyUSD {
+			return Exhausted{Budget: b.Name}
+		}
+	}
+
+	return nil
+}
+
+// Record adds a request's usage to the monthly totals of its user and API key.
+// Both totals are updated in one transaction, and each update adds to the row
+// in place, so concurrent requests don't lose each other's usage.
+func Record(ctx context.Context, db *postgres.DB, subject Subject, u Usage, costUSD float64) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	q := db.Queries.WithTx(tx)
+
+	month := pgtype.Timestamptz{Time: MonthStart(time.Now()), Valid: true}
+	for scope, value := range map[Scope]string{ScopeUser: subject.UserID, ScopeAPIKey: subject.APIKeyID} {
+		if value == "" {
+			continue
+		}
+		err := q.AddMonthlyUsage(ctx, sqlc.AddMonthlyUsageParams{
+			Scope:            string(scope),
+			Subject:          value,
+			MonthStart:       month,
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			CostUsd:          costUSD,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record %s usage: %w", scope, err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Monthly returns the usage of one user or API key in the month starting at month
+func Monthly(ctx context.Context, db *postgres.DB, scope Scope, subject string, month time.Time) (Total, error) {
+	row, err := db.Queries.GetMonthlyUsage(ctx, sqlc.GetMonthlyUsageParams{
+		Scope:      string(scope),
+		Subject:    subject,
+		MonthStart: pgtype.Timestamptz{Time: month, Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Total{Scope: string(scope), Subject: subject, Month: month}, nil
+	}
+	if err != nil {
+		return Total{}, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return totalFromRow(row), nil
+}
+
+// List returns every user's and API key's usage in the month starting at month, highest spend first
+func List(ctx context.Context, db *postgres.DB, month time.Time) ([]Total, error) {
+	rows, err := db.Queries.ListMonthlyUsage(ctx, pgtype.Timestamptz{Time: month, Valid: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage: %w", err)
+	}
+
+	totals := make([]Total, 0, len(rows))
+	for _, row := range rows {
+		totals = append(totals, totalFromRow(row))
+	}
+	return totals, nil
+}
+
+func totalFromRow(row sqlc.UsageMonthly) Total {
+	return Total{
+		Scope:            row.Scope,
+		Subject:          row.Subject,
+		Month:            row.MonthStart.Time,
+		Requests:         row.Requests,
+		PromptTokens:     row.PromptTokens,
+		CompletionTokens: row.CompletionTokens,
+		CostUSD:          row.CostUsd,
+	}
+}
+
+// MonthStart is the start of the calendar month (UTC) containing t
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
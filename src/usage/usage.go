@@ -0,0 +1,80 @@
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Usage is the token count reported by the provider for one request
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// Total is the number of tokens billed
+func (u Usage) Total() int64 {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+type rawUsage struct {
+	Usage    *rawTokens `json:"usage"`
+	Response *struct {
+		Usage *rawTokens `json:"usage"`
+	} `json:"response"` // Responses API stream events wrap the response
+}
+
+// rawTokens holds chat and completions counts, or the Responses API's input and output counts
+type rawTokens struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+}
+
+// Parse reads the usage object from an OpenAI-format response. For streams it
+// is taken from the last chunk or event that has one. It returns false when the
+// provider did not report usage.
+func Parse(body []byte, streaming bool) (Usage, bool) {
+	if !streaming {
+		return parseObject(body)
+	}
+
+	var found Usage
+	var ok bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		if u, chunkOK := parseObject([]byte(strings.TrimPrefix(line, "data:"))); chunkOK {
+			found, ok = u, true
+		}
+	}
+
+	return found, ok
+}
+
+func parseObject(data []byte) (Usage, bool) {
+	var raw rawUsage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Usage{}, false
+	}
+
+	tokens := raw.Usage
+	if tokens == nil && raw.Response != nil {
+		tokens = raw.Response.Usage
+	}
+	if tokens == nil {
+		return Usage{}, false
+	}
+
+	return Usage{
+		PromptTokens:     tokens.PromptTokens + tokens.InputTokens,
+		CompletionTokens: tokens.CompletionTokens + tokens.OutputTokens,
+	}, true
+}
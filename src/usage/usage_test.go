@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		streaming bool
+		want      Usage
+		wantOK    bool
+	}{
+		{"chat", `{"usage":{"prompt_tokens":12,"completion_tokens":30,"total_tokens":42}}`, false, Usage{12, 30}, true},
+		{"responses", `{"object":"response","usage":{"input_tokens":7,"output_tokens":3}}`, false, Usage{7, 3}, true},
+		{"no usage", `{"id":"chatcmpl-1"}`, false, Usage{}, false},
+		{"null usage", `{"usage":null}`, false, Usage{}, false},
+		{"not json", `<html>502</html>`, false, Usage{}, false},
+		{
+			"chat stream",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":1}}\n\ndata: [DONE]\n",
+			true, Usage{5, 1}, true,
+		},
+		{
+			"responses stream",
+			"event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"usage\":null}}\n\nevent: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":4,\"output_tokens\":2}}}\n",
+			true, Usage{4, 2}, true,
+		},
+		{"stream without usage", "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n", true, Usage{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse([]byte(tt.body), tt.streaming)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Parse() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"mid month", time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"first instant", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"other zone", time.Date(2026, 4, 1, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MonthStart(tt.t); !got.Equal(tt.want) {
+				t.Errorf("MonthStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
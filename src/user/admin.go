@@ -0,0 +1,39 @@
+package user
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+type rawAdminConfig struct {
+	Admin struct {
+		APIKeyEnv string `yaml:"api_key_env"`
+	} `yaml:"admin"`
+}
+
+// ReadAdminKey reads the admin API key from the environment variable named by
+// admin.api_key_env in a config file. It is empty when none is configured.
+func ReadAdminKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var raw rawAdminConfig
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return "", err
+	}
+
+	if raw.Admin.APIKeyEnv == "" {
+		return "", nil
+	}
+	return os.Getenv(raw.Admin.APIKeyEnv), nil
+}
+
+// IsAdminKey reports whether apiKey is the admin key. No key is the admin key
+// when none is configured.
+func IsAdminKey(adminKey, apiKey string) bool {
+	return adminKey != "" && subtle.ConstantTimeCompare([]byte(adminKey), []byte(apiKey)) == 1
+}
@@ -2,6 +2,7 @@ package user
 
 import (
 	"covalence/src/types"
+	"math/rand/v2"
 	"net/url"
 	"time"
 )
@@ -15,4 +16,56 @@ type Model struct {
 	CreatedAt time.Time
 	Status    types.Status // Status of the model (active, inactive, etc.)
 	Provider  types.ModelProvider
+	Targets   []Target // Weighted pool of backends; empty routes everything to Model at APIURL
+	Fallbacks []Target // Tried in order when the chosen target fails
+}
+
+// ========================= Target =========================
+
+// Target is one backend an alias can route to
+type Target struct {
+	Model    types.ModelID
+	APIURL   *url.URL
+	Provider types.ModelProvider
+	Weight   int
+}
+
+// Pool returns the backends the alias routes to
+func (m Model) Pool() []Target {
+	if len(m.Targets) > 0 {
+		return m.Targets
+	}
+	return []Target{{
+		Model:    m.Model,
+		APIURL:   m.APIURL,
+		Provider: m.Provider,
+		Weight:   1,
+	}}
+}
+
+// PickTarget chooses a backend at random, in proportion to the target weights
+func (m Model) PickTarget() Target {
+	pool := m.Pool()
+
+	total := 0
+	for _, t := range pool {
+		total += t.Weight
+	}
+	if total <= 0 {
+		return pool[0]
+	}
+
+	n := rand.IntN(total)
+	for _, t := range pool {
+		if n < t.Weight {
+			return t
+		}
+		n -= t.Weight
+	}
+	return pool[len(pool)-1]
+}
+
+// Attempts returns the chosen target followed by the alias's fallbacks
+func (m Model) Attempts(chosen Target) []Target {
+	return append([]Target{chosen}, m.Fallbacks...)
 }
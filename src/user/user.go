@@ -2,19 +2,23 @@ package user
 
 import "github.com/google/uuid"
 
+// Namespaces for deriving IDs from API keys, so the same key always maps to
+// the same user and key ID
+var (
+	apiKeyNamespace = uuid.MustParse("8be5b4d6-53be-4a3f-a344-e102a31bba57")
+	userNamespace   = uuid.MustParse("a17faab6-55bc-46fb-a004-e6b976879519")
+)
+
 type User struct {
 	ID       uuid.UUID
 	APIKeyID uuid.UUID
 }
 
 func GetUserByAPIKey(apiKey string) (User, error) {
-	// hash api key
-
-	// lookup api key id in db
-
-	// for now, leave it random
+	// Until keys are looked up in a user store, IDs are hashes of the key and
+	// every key is its own user
 	return User{
-		ID:       uuid.New(),
-		APIKeyID: uuid.New(),
+		ID:       uuid.NewSHA1(userNamespace, []byte(apiKey)),
+		APIKeyID: uuid.NewSHA1(apiKeyNamespace, []byte(apiKey)),
 	}, nil
 }
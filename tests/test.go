@@ -19,6 +19,9 @@ func main() {
 	}
 	defer db.Close()
 
+	// Audit records are written in the background
+	writer := audit.NewWriter(db, audit.DefaultWriterConfig())
+
 	// Generate UUIDs
 	userID := audit.NewUUID()
 	apiKeyID := audit.NewUUID()
@@ -34,7 +37,7 @@ func main() {
 	}
 
 	// Log a request
-	requestID, err := audit.LogRequest(ctx, request, db)
+	requestID, err := writer.LogRequest(ctx, request)
 	if err != nil {
 		log.Fatal("Failed to log request:", err)
 	}
@@ -46,7 +49,7 @@ func main() {
 		LatencyMs: 150,
 	}
 	// Log a response
-	err = audit.LogResponse(ctx, response, db)
+	err = writer.LogResponse(ctx, response)
 	if err != nil {
 		log.Fatal("Failed to log response:", err)
 	}
@@ -62,14 +65,19 @@ func main() {
 	}
 
 	// Log a firewall event
-	err = audit.LogFirewallEvent(ctx, firewallEvent, db)
+	err = writer.LogFirewallEvent(ctx, firewallEvent)
 	if err != nil {
 		log.Fatal("Failed to log firewall event:", err)
 	}
 	fmt.Println("Firewall event logged")
 
+	// Write everything queued before reading it back
+	if err := writer.Close(ctx); err != nil {
+		log.Fatal("Failed to flush audit records:", err)
+	}
+
 	// Get trace
-	trace, err := audit.GetTrace(ctx, requestID, db)
+	trace, err := audit.GetTrace(ctx, requestID, db, nil)
 	if err != nil {
 		log.Fatal("Failed to get trace:", err)
 	}